@@ -7,17 +7,81 @@ package main
 import (
 	"./model"
 	"./util"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/fractalcat/nagiosplugin"
+	"io/ioutil"
+	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 const (
-	CredFile = ".mongodb_mms"
+	CredFile  = ".mongodb_mms"
+	CacheFile = ".mongodb_mms_cache"
 )
 
+// How long after the --max-runtime deadline the whole run is abandoned.
+const maxRuntimeGrace = 250 * time.Millisecond
+
+// Metrics checked by the curated check modes.
+const (
+	IndexBuildsMetric     = "INDEX_BUILDS"
+	ElectionsMetric       = "REPLSET_ELECTIONS"
+	GlobalLockMetric      = "GLOBAL_LOCK_PERCENTAGE"
+	CursorsOpenMetric     = "CURSORS_TOTAL_OPEN"
+	CursorsTimedOutMetric = "CURSORS_TOTAL_TIMED_OUT"
+	OplogRateMetric       = "OPLOG_RATE_GB_PER_HOUR"
+	ScannedObjectsMetric  = "QUERY_EXECUTOR_SCANNED_OBJECTS"
+	ReturnedDocsMetric    = "DOCUMENT_METRICS_RETURNED"
+	DBStorageMetric       = "DB_STORAGE_TOTAL"
+)
+
+// wiredTigerMetrics maps the --wiredtiger values to their metrics.
+var wiredTigerMetrics = map[string]string{
+	"dirty":    "CACHE_DIRTY_BYTES",
+	"used":     "CACHE_USED_BYTES",
+	"eviction": "CACHE_BYTES_WRITTEN_FROM",
+}
+
+// wiredTigerDefaults are the percent of cache thresholds used when -w and -c
+// are not given, matching the points at which WiredTiger itself starts
+// evicting more aggressively.
+var wiredTigerDefaults = map[string][2]string{
+	"dirty": {"5", "20"},
+	"used":  {"80", "95"},
+}
+
+// policyStatuses maps the values of status policy flags such as --on-no-host
+// to nagios statuses. The status names may be spelled out or abbreviated.
+var policyStatuses = map[string]nagiosplugin.Status{
+	"ok":       nagiosplugin.OK,
+	"warn":     nagiosplugin.WARNING,
+	"warning":  nagiosplugin.WARNING,
+	"crit":     nagiosplugin.CRITICAL,
+	"critical": nagiosplugin.CRITICAL,
+	"unknown":  nagiosplugin.UNKNOWN,
+}
+
+// assertionMetrics maps the --assertion-type values to their counters.
+var assertionMetrics = map[string][]string{
+	"regular": {"ASSERT_REGULAR"},
+	"warning": {"ASSERT_WARNING"},
+	"msg":     {"ASSERT_MSG"},
+	"user":    {"ASSERT_USER"},
+	"all":     {"ASSERT_REGULAR", "ASSERT_WARNING", "ASSERT_MSG", "ASSERT_USER"},
+}
+
 var groupId string
 var hostname string
 var metricName string
@@ -31,116 +95,2877 @@ var granularity string
 var period string
 var username string
 var apiKey string
+var agentErrors bool
+var agentType string
+var agentPattern string
+var strictNagios bool
+var strictMaxLength int
+var detectCounters bool
+var cacheFile string
+var cache *util.Cache
+var replicaSet string
+var expectVoters int
+var expandShards bool
+var unitOverrides = util.UnitOverrides{}
+var autoGranularity bool
+var indexBuilds bool
+var steppedThresholds string
+var includeHidden bool
+var probeLatency bool
+var output string
+var perfDataAll bool
+var nullPolicy string
+var maxRuntime int
+var deadline time.Time
+var hostAggregation string
+var labelWithHost bool
+var metricMapFile string
+var bundle string
+var validate bool
+var waitFor int
+var pollInterval int
+var growth string
+var capacity string
+var configServers bool
+var excludes util.Patterns
+var deployment bool
+var headers = util.Headers{}
+var elections bool
+var assertionType string
+var dumpRaw bool
+var serverFallback string
+var verbose bool
+var wiredTiger string
+var cacheSize string
+var rateSinceLastRun bool
+var expectShards int
+var chunkSkew float64
+var onNoHost string
+var envelope bool
+var finishMutex sync.Mutex
+var outputFile string
+var automationDrift bool
+var thresholdPerHost bool
+var fromAlertConfig bool
+var thresholdSource string
+var globalLock bool
+var compactPerfData bool
+var perfDataPrecision int
+var activeWindow string
+var probeAllMetrics bool
+var concurrency int
+var cursors bool
+var warnOnDeprecation bool
+var certExpiry bool
+var warnDays int
+var critDays int
+var minHealthyPercent float64
+var criticalHealthyPercent float64
+var color bool
+var noColor bool
+var oplogChurn bool
+var oplogSize string
+var noDedupe bool
+var testAuth bool
+var perTargetTimeout int
+var scanRatio bool
+var rateLimit string
+var zScore bool
+var stalenessSource string
+var topologyTTL int
+var parameter string
+var warnOnRedirectHostMismatch bool
+var strictHost bool
+var databaseCount bool
+var explain bool
+var traceFile string
+var gracePeriod string
+var otlpEndpoint string
+var valueField string
+var summarize bool
+var summarizeThreshold string
+var function string
+var retries int
+var listMetrics bool
+var proxy string
+var staleStatus string
+var cluster string
+var realm string
+var expectType string
+var rateOfChange bool
+var hostId string
+var checkAlerts bool
+var caFile string
+var insecure bool
+var exactCounters bool
+
+func main() {
+	setupFlags()
+	if indexBuilds {
+		metricName = IndexBuildsMetric
+	}
+	if elections {
+		metricName = ElectionsMetric
+	}
+
+	if len(missingFlags()) > 0 {
+		// Callers that asked for JSON get an error they can parse rather
+		// than the usage text.
+		if hasOutput("json") {
+			report := util.NewReport()
+			report.AddResultf(nagiosplugin.UNKNOWN, "Missing required flags: %v", strings.Join(missingFlags(), ", "))
+			finish(report)
+		}
+
+		flag.Usage()
+		os.Exit(2)
+		return
+	}
+
+	check := util.NewReport()
+	defer finish(check)
+
+	// Nagios sends SIGTERM to a check that overruns its timeout. Report that
+	// rather than dying without any output.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		received := <-signals
+		report := util.NewReport()
+		report.AddResultf(nagiosplugin.UNKNOWN, "Check was terminated by %v before it completed", received)
+		finish(report)
+	}()
+
+	if err := applyConfig(); err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	// Both are put into the request URL as they are, where a typo only gets
+	// an opaque error from the API.
+	if !autoGranularity && granularity != "MINUTE" && granularity != "HOUR" && granularity != "DAY" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Invalid granularity %v. Acceptable values are MINUTE HOUR DAY", granularity)
+		return
+	}
+
+	if _, err := util.ParsePeriod(period); err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	if nullPolicy != "skip" && nullPolicy != "unknown" && nullPolicy != "zero" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Invalid null policy %v. Acceptable values are skip unknown zero", nullPolicy)
+		return
+	}
+
+	if bundle != "" && metricMapFile == "" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--bundle requires --metric-map")
+		return
+	}
+
+	if hostAggregation != "worst" && hostAggregation != "sum" && hostAggregation != "max" && hostAggregation != "avg" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Invalid host aggregation %v. Acceptable values are sum max avg worst", hostAggregation)
+		return
+	}
+
+	if _, ok := assertionMetrics[assertionType]; assertionType != "" && ok == false {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Invalid assertion type %v. Acceptable values are regular warning msg user all", assertionType)
+		return
+	}
+
+	if _, ok := wiredTigerMetrics[wiredTiger]; wiredTiger != "" && ok == false {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Invalid WiredTiger check %v. Acceptable values are dirty used eviction", wiredTiger)
+		return
+	}
+
+	if defaults, ok := wiredTigerDefaults[wiredTiger]; ok && warning == "~:" && critical == "~:" && steppedThresholds == "" {
+		warning, critical = defaults[0], defaults[1]
+	}
+
+	// Values more than three standard deviations from the mean warn unless
+	// told otherwise.
+	if zScore && warning == "~:" && critical == "~:" && steppedThresholds == "" {
+		warning, critical = "-3:3", "-4:4"
+	}
+
+	if gracePeriod != "" {
+		if _, err := util.ParsePeriod(gracePeriod); err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "Invalid grace period. Error: %v", err)
+			return
+		}
+	}
+
+	if function != "last" && function != "avg" && function != "min" && function != "max" && function != "p95" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Invalid function %v. Acceptable values are last avg min max p95", function)
+		return
+	}
+
+	if summarizeThreshold != "last" && summarizeThreshold != "min" && summarizeThreshold != "avg" && summarizeThreshold != "max" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Invalid --summarize-threshold %v. Acceptable values are last min avg max", summarizeThreshold)
+		return
+	}
+
+	if stalenessSource != "datapoint" && stalenessSource != "lastping" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Invalid staleness source %v. Acceptable values are datapoint lastping", stalenessSource)
+		return
+	}
+
+	if _, ok := policyStatuses[staleStatus]; ok == false {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Invalid --stale-status %v. Acceptable values are ok warning critical unknown", staleStatus)
+		return
+	}
+
+	if _, ok := policyStatuses[onNoHost]; ok == false {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Invalid --on-no-host policy %v. Acceptable values are ok warn crit unknown", onNoHost)
+		return
+	}
+
+	// Any process behind the goal version warns unless told otherwise.
+	if automationDrift && warning == "~:" && critical == "~:" && steppedThresholds == "" {
+		warning = "0"
+	}
+
+	if perTargetTimeout < 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--per-target-timeout must not be negative")
+		return
+	}
+
+	if hostname != "" && hostId != "" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--hostname and --hostid are mutually exclusive, give only one of them")
+		return
+	}
+
+	if retries < 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--retries must not be negative")
+		return
+	}
+
+	// The list is long output, which only the nagios output has.
+	if listMetrics && output != "nagios" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--list-metrics only supports the nagios output")
+		return
+	}
+
+	if waitFor > 0 && pollInterval < 1 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--poll-interval must be at least 1 second")
+		return
+	}
+
+	if concurrency < 1 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--concurrency must be at least 1")
+		return
+	}
+
+	if rateSinceLastRun && cacheFile == "" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--rate-since-last-run requires a --cache-file to keep the last value in")
+		return
+	}
+
+	if growth != "" && growth != "absolute" && growth != "percent" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Invalid growth mode %v. Acceptable values are absolute percent", growth)
+		return
+	}
+
+	for _, format := range strings.Split(output, ",") {
+		if format != "nagios" && format != "json" && format != "csv" && format != "influx-lp" && format != "otlp" {
+			check.AddResultf(nagiosplugin.UNKNOWN, "Invalid output format %v. Acceptable values are nagios json csv influx-lp otlp", format)
+			output = "nagios"
+			return
+		}
+	}
+
+	if strings.Contains(output, ",") && outputFile == "" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "More than one --output format requires --output-file")
+		output = "nagios"
+		return
+	}
+
+	if activeWindow != "" {
+		window, err := util.ParseActiveWindow(activeWindow)
+		if err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+
+		if window.Contains(time.Now()) == false {
+			check.AddResultf(nagiosplugin.OK, "Outside the active window %v, check suppressed", activeWindow)
+			return
+		}
+	}
+
+	cache = util.LoadCache(cacheFile)
+	defer cache.Save()
+
+	var err error
+	if autoGranularity {
+		granularity, err = util.AutoGranularity(period)
+		if err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+	}
+
+	api, err := util.NewMMSAPI(server, timeout, username, apiKey)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Failed to create API. Error: %v", err)
+		return
+	}
+	defer api.Close()
+
+	for name, value := range headers {
+		api.SetHeader(name, value)
+	}
+
+	if serverFallback != "" {
+		api.SetFallback(serverFallback)
+	}
+
+	if realm != "" {
+		api.SetRealm(realm)
+	}
+
+	if caFile != "" {
+		if err := api.SetCAFile(caFile); err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+	}
+
+	if insecure {
+		fmt.Fprintf(os.Stderr, "Warning: not verifying the certificate of %v\n", server)
+		api.SetInsecure()
+	}
+
+	if proxy != "" {
+		if err := api.SetProxy(proxy); err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+	}
+
+	if noDedupe {
+		api.KeepDuplicates()
+	}
+
+	if exactCounters {
+		api.KeepExactValues()
+	}
+
+	api.SetCache(cache)
+	api.SetRetries(retries)
+
+	// Polling has to see new data, not the response of the first poll.
+	if waitFor > 0 {
+		api.DisableMemoization()
+	}
+
+	if strictHost {
+		api.SetStrictHost()
+	}
+
+	if rateLimit != "" {
+		perSecond, err := util.ParseRateLimit(rateLimit)
+		if err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+		api.SetRateLimit(perSecond)
+	}
+
+	// The timeout bounds the whole run rather than each request, so that
+	// retries and further pages cannot add up to many times the timeout.
+	// Polling and --max-runtime give the run longer.
+	runTimeout := time.Duration(timeout) * time.Second
+	if waitFor > 0 {
+		runTimeout += time.Duration(waitFor) * time.Second
+	}
+	if maxRuntime > 0 {
+		runTimeout = time.Duration(maxRuntime) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+	defer cancel()
+	api = api.WithContext(ctx)
+
+	if fromAlertConfig {
+		if err := applyAlertConfig(api); err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+	}
+
+	if maxRuntime <= 0 {
+		runChecks(check, api)
+		return
+	}
+
+	// Multi-target checks report their partial results at the deadline
+	// itself, so only give up on the whole run slightly after it.
+	deadline = time.Now().Add(time.Duration(maxRuntime) * time.Second)
+	report := util.NewReport()
+	done := make(chan bool)
+	go func() {
+		runChecks(report, api)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		*check = *report
+	case <-time.After(time.Until(deadline) + maxRuntimeGrace):
+		check.AddResultf(nagiosplugin.UNKNOWN, "Check did not complete within the maximum runtime of %v seconds", maxRuntime)
+	}
+}
+
+// missingFlags lists the required flags that were not given.
+func missingFlags() []string {
+	// Testing the credentials does not need a group or host.
+	if testAuth {
+		return nil
+	}
+
+	var missing []string
+	if groupId == "" {
+		missing = append(missing, "--groupid")
+	}
+	if hostname == "" && hostId == "" && replicaSet == "" && cluster == "" && !probeLatency && !deployment && !automationDrift && !certExpiry {
+		missing = append(missing, "--hostname")
+	}
+
+	return missing
+}
+
+// applyAlertConfig replaces the critical threshold with the threshold of the
+// Ops Manager alert config for the metric, so that both alert alike.
+func applyAlertConfig(api *util.MMSAPI) error {
+	if metricName == "" {
+		return errors.New("--from-alert-config requires a metric")
+	}
+
+	alertConfigs, err := api.GetAlertConfigs(groupId)
+	if err != nil {
+		return err
+	}
+
+	alertConfig := alertConfigs.MetricAlertConfig(metricName)
+	if alertConfig == nil {
+		return errors.New(fmt.Sprintf("No enabled alert config found for %v", metricName))
+	}
+
+	critical, err = util.AlertThresholdRange(alertConfig.MetricThreshold)
+	if err != nil {
+		return err
+	}
+
+	thresholdSource = fmt.Sprintf("alert config %v", alertConfig.Id)
+	return nil
+}
+
+// applyConfig fills in the server and credentials that were not given as
+// flags, first from the MMS_SERVER, MMS_USERNAME and MMS_APIKEY environment
+// variables, then from the credentials file in the home directory.
+func applyConfig() error {
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	serverGiven := given["server"] || given["s"]
+	if !serverGiven && os.Getenv("MMS_SERVER") != "" {
+		server = os.Getenv("MMS_SERVER")
+		serverGiven = true
+	}
+
+	if username == "" {
+		username = os.Getenv("MMS_USERNAME")
+	}
+
+	if apiKey == "" {
+		apiKey = os.Getenv("MMS_APIKEY")
+	}
+
+	needCredentials := username == "" || apiKey == ""
+	if !needCredentials && serverGiven {
+		return nil
+	}
+
+	// A credentials file that cannot be used only matters when it has to
+	// supply the credentials; the server alone has a default.
+	config, err := util.FindConfig(CredFile)
+	if err != nil && !os.IsNotExist(err) {
+		if needCredentials {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: ignoring the credentials file. %v\n", err)
+	}
+	if config == nil {
+		return nil
+	}
+
+	if !serverGiven {
+		server = defaultString(config.Server(), server)
+	}
+
+	if username == "" {
+		username = config.Get("username")
+	}
+
+	if apiKey == "" {
+		apiKey = config.Get("apikey")
+	}
+
+	return nil
+}
+
+// checkOptions are the settings of a metric check that differ between the
+// metrics of a --bundle or a comma separated --metric list. Each check gets
+// its own copy rather than overriding the flag variables, which checks still
+// running on other goroutines read.
+type checkOptions struct {
+	metricName        string
+	dbName            string
+	warning           string
+	critical          string
+	steppedThresholds string
+	hostAggregation   string
+}
+
+// flagOptions returns the check options given by the flags.
+func flagOptions() *checkOptions {
+	return &checkOptions{metricName: metricName, dbName: dbName, warning: warning, critical: critical, steppedThresholds: steppedThresholds, hostAggregation: hostAggregation}
+}
+
+// runChecks runs the check mode selected by the flags.
+func runChecks(check *util.Report, api *util.MMSAPI) {
+	opts := flagOptions()
+
+	if warnOnRedirectHostMismatch {
+		defer func() {
+			for _, mismatch := range api.RedirectMismatches() {
+				check.AddResultf(nagiosplugin.WARNING, "MMS/Ops Manager server %v", mismatch)
+			}
+		}()
+	}
+
+	if warnOnDeprecation {
+		defer func() {
+			for _, notice := range api.Deprecations() {
+				check.AddResultf(nagiosplugin.WARNING, "MMS/Ops Manager API deprecation notice: %v", notice)
+			}
+		}()
+	}
+
+	if verbose {
+		defer func() {
+			fmt.Fprintf(os.Stderr, "Answered by %v\n", defaultString(api.AnsweredBy(), "no server"))
+		}()
+	}
+
+	if testAuth {
+		doTestAuth(check, api)
+		return
+	}
+
+	if probeLatency {
+		doLatencyCheck(check, api)
+		return
+	}
+
+	if replicaSet != "" {
+		doReplicaSetCheck(check, api, opts)
+		return
+	}
+
+	if cluster != "" {
+		doClusterCheck(check, api, opts)
+		return
+	}
+
+	if deployment {
+		doDeploymentCheck(check, api)
+		return
+	}
+
+	if automationDrift {
+		doAutomationDriftCheck(check, api, opts)
+		return
+	}
+
+	if certExpiry {
+		doCertExpiryCheck(check, api)
+		return
+	}
+
+	host, err := lookupHost(api)
+	if util.IsNotFound(err) {
+		// A wrong group answers the host lookup with the same 404 as a host
+		// that is not in it, which the policy is not meant for.
+		if _, err := api.Ping(groupId); err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "Group %v could not be read. Error: %v", groupId, err)
+			return
+		}
+
+		check.AddResultf(policyStatuses[onNoHost], "Host %v not found in group %v", defaultString(hostname, hostId), groupId)
+		return
+	}
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	switch {
+	case validate:
+		doValidate(check, api, opts, host)
+	case probeAllMetrics:
+		doProbeAllMetrics(check, api, host)
+	case listMetrics:
+		doListMetrics(check, api, host)
+	case bundle != "":
+		doBundleChecks(check, api, opts, host)
+	case waitFor > 0:
+		doWaitForChecks(check, api, opts, host)
+	case configServers:
+		doConfigServersCheck(check, api, host)
+	case expectShards > 0 || chunkSkew > 0:
+		doShardBalanceCheck(check, api, host)
+	case expandShards:
+		doShardsCheck(check, api, opts, host)
+	default:
+		doChecks(check, api, opts, host)
+	}
+
+	// Multi-target checks always prefix their perfdata labels with the host.
+	if labelWithHost && !expandShards {
+		check.PrefixPerfData(util.SanitizeLabel(host.ShortName()) + "_")
+	}
+}
+
+// lookupHost finds the host given by --hostname, or by --hostid. A metric
+// check only needs the ID of the host, so with --hostid it is not looked up
+// at all unless the check depends on the state of the host. Without that
+// state, hidden members are not told apart.
+func lookupHost(api *util.MMSAPI) (*model.Host, error) {
+	if hostId == "" {
+		return api.GetHostByName(groupId, hostname)
+	}
+
+	needsState := metricName == "" || expandShards || configServers || expectShards > 0 || chunkSkew > 0 || stalenessSource == "lastping" || gracePeriod != ""
+	if needsState {
+		return api.GetHost(groupId, hostId)
+	}
+
+	return &model.Host{Id: hostId}, nil
+}
+
+// doValidate confirms that the host, metric, database and thresholds given
+// on the command line all exist or parse, without evaluating any values.
+func doValidate(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	check.AddResultf(nagiosplugin.OK, "Host %v resolved to %v", defaultString(hostname, hostId), host.Id)
+
+	units := ""
+	if opts.metricName != "" {
+		metrics, err := api.GetHostMetrics(groupId, host.Id)
+		if err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+
+		found := false
+		for _, metric := range metrics {
+			if metric.MetricName == opts.metricName {
+				found = true
+				units = metric.Units
+			}
+		}
+
+		if found {
+			check.AddResultf(nagiosplugin.OK, "Metric %v exists", opts.metricName)
+		} else {
+			check.AddResultf(nagiosplugin.UNKNOWN, "Metric %v is not available for this host", opts.metricName)
+		}
+	}
+
+	if opts.dbName != "" {
+		databases, err := api.GetHostDatabases(groupId, host.Id)
+		if err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+
+		found := false
+		for _, database := range databases {
+			found = found || database.DatabaseName == opts.dbName
+		}
+
+		if found {
+			check.AddResultf(nagiosplugin.OK, "Database %v exists", opts.dbName)
+		} else {
+			check.AddResultf(nagiosplugin.UNKNOWN, "Database %v not found on this host", opts.dbName)
+		}
+	}
+
+	if opts.steppedThresholds != "" {
+		if _, err := util.ParseSteppedThresholds(opts.steppedThresholds, units); err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing thresholds. Error: %v", err)
+		} else {
+			check.AddResultf(nagiosplugin.OK, "Thresholds parse")
+		}
+		return
+	}
+
+	if _, err := parseRange(opts.critical, units, 1); err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing critical range. Error: %v", err)
+	} else if _, err := parseRange(opts.warning, units, 1); err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing warning range. Error: %v", err)
+	} else {
+		check.AddResultf(nagiosplugin.OK, "Thresholds parse")
+	}
+}
+
+// doProbeAllMetrics fetches the latest value of every metric the host reports,
+// at most --concurrency at a time, as a snapshot of the host. Metrics not
+// fetched by the --max-runtime deadline are left out.
+func doProbeAllMetrics(check *util.Report, api *util.MMSAPI, host *model.Host) {
+	summaries, err := api.GetHostMetrics(groupId, host.Id)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	type fetchResult struct {
+		index  int
+		metric *model.Metric
+		err    error
+	}
+
+	results := make(chan fetchResult, len(summaries))
+	slots := make(chan bool, concurrency)
+	for i, summary := range summaries {
+		go func(i int, name string) {
+			slots <- true
+			defer func() { <-slots }()
+
+			// A metric that fails to fetch is left out of the snapshot.
+			metric, err := api.GetHostMetric(groupId, host.Id, name, granularity, period)
+			results <- fetchResult{i, metric, err}
+		}(i, summary.MetricName)
+	}
+
+	// Without a --max-runtime deadline the timeout channel stays nil and
+	// every metric is waited for.
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timeout = time.After(time.Until(deadline))
+	}
+
+	metrics := make([]*model.Metric, len(summaries))
+	var fetchErr error
+	for received := 0; received < len(summaries); received++ {
+		select {
+		case result := <-results:
+			metrics[result.index] = result.metric
+			if fetchErr == nil {
+				fetchErr = result.err
+			}
+		case <-timeout:
+			received = len(summaries)
+		}
+	}
+
+	fetched := 0
+	var values []string
+	for i, metric := range metrics {
+		if metric == nil {
+			continue
+		}
+
+		index := metric.LastNonNullIndex()
+		if index < 0 {
+			continue
+		}
+
+		fetched++
+		check.AddPerfDatum(summaries[i].MetricName, "", metric.DataPoints[index].Value)
+		values = append(values, metric.ToStringDataPoint(index))
+	}
+
+	// A snapshot without any values says nothing about the host.
+	if fetched == 0 {
+		if fetchErr != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "No values of the %v metrics could be fetched. Error: %v", len(summaries), fetchErr)
+		} else {
+			check.AddResultf(nagiosplugin.UNKNOWN, "No values of the %v metrics could be fetched", len(summaries))
+		}
+		return
+	}
+
+	check.AddResultf(nagiosplugin.OK, "Snapshot of %v of %v metrics: %v", fetched, len(summaries), strings.Join(values, ", "))
+}
+
+// doListMetrics prints the name and units of every metric the host reports,
+// to help find the name to pass to --metric, without checking any of them.
+func doListMetrics(check *util.Report, api *util.MMSAPI, host *model.Host) {
+	summaries, err := api.GetHostMetrics(groupId, host.Id)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].MetricName < summaries[j].MetricName
+	})
+
+	// The list follows the status line as long output, so that the first
+	// line is still the plugin output.
+	list := util.NewReport()
+	for _, summary := range summaries {
+		list.AddResultf(nagiosplugin.OK, "%v %v", summary.MetricName, summary.Units)
+	}
+	check.Groups = append(check.Groups, util.ReportGroup{Name: fmt.Sprintf("Metrics of %v", host.Name()), Status: nagiosplugin.OK, Results: list.Results})
+
+	check.AddResultf(nagiosplugin.OK, "%v metrics available for %v", len(summaries), host.Name())
+}
+
+// doWaitForChecks repeats the check every --poll-interval seconds until it is
+// OK or --wait-for seconds have passed, reporting the last result.
+func doWaitForChecks(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	start := time.Now()
+	waitDeadline := start.Add(time.Duration(waitFor) * time.Second)
+	if !deadline.IsZero() && deadline.Before(waitDeadline) {
+		waitDeadline = deadline
+	}
+
+	for polls := 0; ; polls++ {
+		// The state of the host, such as its last ping, changes between
+		// polls as well as its metrics.
+		var err error
+		if polls > 0 {
+			host, err = lookupHost(api)
+		}
+
+		report := util.NewReport()
+		if err != nil {
+			report.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		} else {
+			doChecks(report, api, opts, host)
+		}
+
+		waited := int(time.Since(start).Seconds())
+		if report.ExitStatus() == nagiosplugin.OK {
+			check.Append(report)
+			check.AddResultf(nagiosplugin.OK, "OK after waiting %v seconds", waited)
+			return
+		}
+
+		if time.Now().Add(time.Duration(pollInterval) * time.Second).After(waitDeadline) {
+			check.Append(report)
+			check.AddResultf(report.ExitStatus(), "Still not OK after waiting %v seconds", waited)
+			return
+		}
+
+		select {
+		case <-time.After(time.Duration(pollInterval) * time.Second):
+		case <-api.Context().Done():
+		}
+	}
+}
+
+// doBundleChecks runs a metric check for every metric of the --bundle,
+// taking the thresholds and aggregation for each from the metric map.
+func doBundleChecks(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	metricMap, err := util.LoadMetricMap(metricMapFile)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	metrics, err := metricMap.Bundle(bundle)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	for _, metric := range metrics {
+		metricOpts := &checkOptions{
+			metricName:        metric.Metric,
+			dbName:            metric.DBName,
+			warning:           defaultString(metric.Warning, "~:"),
+			critical:          defaultString(metric.Critical, "~:"),
+			steppedThresholds: metric.Thresholds,
+			hostAggregation:   defaultString(metric.HostAggregation, opts.hostAggregation),
+		}
+
+		report := util.NewReport()
+		if expandShards {
+			doShardsCheck(report, api, metricOpts, host)
+		} else {
+			doMetricCheck(report, api, metricOpts, host)
+		}
+		check.Append(report)
+	}
+}
+
+func defaultString(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
+// doChecks runs the check selected by the flags against a single host.
+func doChecks(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	if age, ok := inGracePeriod(host); ok {
+		defer check.Downgrade(nagiosplugin.CRITICAL, nagiosplugin.WARNING, fmt.Sprintf("host added %v ago, within the grace period", age))
+	}
+
+	switch {
+	case agentErrors:
+		doAgentErrorCheck(check, api, opts, host)
+	case checkAlerts:
+		doAlertsCheck(check, api, host)
+	case assertionType != "":
+		doAssertionCheck(check, api, opts, host)
+	case wiredTiger != "":
+		doWiredTigerCheck(check, api, opts, host)
+	case globalLock:
+		doGlobalLockCheck(check, api, opts, host)
+	case cursors:
+		doCursorsCheck(check, api, opts, host)
+	case oplogChurn:
+		doOplogChurnCheck(check, api, opts, host)
+	case scanRatio:
+		doScanRatioCheck(check, api, opts, host)
+	case parameter != "":
+		doParameterCheck(check, api, host)
+	case databaseCount:
+		doDatabaseCountCheck(check, api, opts, host)
+	case opts.metricName == "":
+		doHostCheck(check, opts, host)
+	case growth != "":
+		doGrowthCheck(check, api, opts, host)
+	case elections:
+		doIncreaseCheck(check, api, opts, host, "elections")
+	case rateSinceLastRun:
+		doRateSinceLastRunCheck(check, api, opts, host)
+	case rateOfChange:
+		doRateCheck(check, api, opts, host)
+	case envelope:
+		doEnvelopeCheck(check, api, opts, host)
+	case zScore:
+		doZScoreCheck(check, api, opts, host)
+	case summarize:
+		doSummaryCheck(check, api, opts, host)
+	default:
+		doMetricCheck(check, api, opts, host)
+	}
+}
+
+// inGracePeriod reports whether the host was added less than --grace-period
+// ago, and how long ago it was added. Hosts that are still settling in only
+// warn where they would otherwise be critical.
+func inGracePeriod(host *model.Host) (time.Duration, bool) {
+	if gracePeriod == "" || host.Created.IsZero() {
+		return 0, false
+	}
+
+	grace, _ := util.ParsePeriod(gracePeriod)
+	age := time.Since(host.Created)
+
+	return age.Round(time.Minute), age < grace
+}
+
+// ignoreHidden reports whether host is a hidden member that should not be
+// flagged as stale or problematic, unless --include-hidden is given.
+func ignoreHidden(host *model.Host) bool {
+	return host.IsHidden() && !includeHidden
+}
+
+// isExcluded reports whether the host matches one of the --exclude patterns
+// and should be left out of multi-host checks.
+func isExcluded(host *model.Host) bool {
+	return excludes.MatchAny(host.Name())
+}
+
+// doShardsCheck runs the selected check concurrently against every shard
+// member behind a mongos, reporting the worst status of them all.
+func doShardsCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, mongos *model.Host) {
+	if mongos.TypeName != "SHARD_MONGOS" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--expand-shards requires a mongos host but %v is %v", hostname, mongos.TypeName)
+		return
+	}
+
+	hosts, err := topologyHosts(api)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	var members []model.Host
+	for _, host := range hosts {
+		if host.ParentClusterId == mongos.ClusterId && host.IsShardMember() && !ignoreHidden(&host) && !isExcluded(&host) {
+			members = append(members, host)
+		}
+	}
+
+	if len(members) == 0 {
+		invalidateTopology()
+		check.AddResultf(nagiosplugin.UNKNOWN, "No shard members found behind %v", hostname)
+		return
+	}
+
+	// Checks of the state of the members need it from this run.
+	if opts.metricName == "" || stalenessSource == "lastping" {
+		members, err = currentHosts(api, members)
+		if err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+	}
+
+	if opts.hostAggregation != "worst" {
+		doAggregateChecks(check, api, opts, members)
+		return
+	}
+
+	doTargetChecks(check, api, opts, members)
+}
+
+// topologyHosts lists the hosts of the group to resolve the members of a
+// cluster. With --topology-ttl the list is reused across runs, so only the
+// topology of the hosts can be relied on, see currentHosts.
+func topologyHosts(api *util.MMSAPI) ([]model.Host, error) {
+	if topologyTTL <= 0 {
+		return api.GetAllHosts(groupId)
+	}
+
+	return util.CachedHosts(api, cache, groupId, time.Duration(topologyTTL)*time.Second)
+}
+
+// currentHosts returns the hosts resolved by topologyHosts with their state,
+// such as the last ping, as of this run. Hosts that were just listed already
+// have it, and cached ones are fetched again, dropping the cached topology if
+// that fails.
+func currentHosts(api *util.MMSAPI, hosts []model.Host) ([]model.Host, error) {
+	if topologyTTL <= 0 {
+		return hosts, nil
+	}
+
+	current, err := util.RefreshHosts(api, groupId, hosts)
+	if err != nil {
+		invalidateTopology()
+		return nil, err
+	}
+
+	return current, nil
+}
+
+// invalidateTopology drops the cached hosts after an error that suggests the
+// topology changed since they were fetched.
+func invalidateTopology() {
+	if topologyTTL > 0 {
+		util.InvalidateHosts(cache, groupId)
+	}
+}
+
+// doConfigServersCheck checks that every config server of the cluster behind
+// a mongos has pinged within --maxage. Any config server that has not is
+// CRITICAL, as the cluster cannot change its metadata without all of them.
+func doConfigServersCheck(check *util.Report, api *util.MMSAPI, mongos *model.Host) {
+	if mongos.TypeName != "SHARD_MONGOS" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--config-servers requires a mongos host but %v is %v", hostname, mongos.TypeName)
+		return
+	}
+
+	hosts, err := topologyHosts(api)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	var configHosts []model.Host
+	for _, host := range hosts {
+		if host.ParentClusterId == mongos.ClusterId && host.IsConfigServer() && !isExcluded(&host) {
+			configHosts = append(configHosts, host)
+		}
+	}
+
+	if len(configHosts) == 0 {
+		invalidateTopology()
+		check.AddResultf(nagiosplugin.UNKNOWN, "No config servers found behind %v", hostname)
+		return
+	}
+
+	configHosts, err = currentHosts(api, configHosts)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	var down []string
+	for _, host := range configHosts {
+		age := time.Since(host.LastPing)
+		if age.Seconds() > float64(maxAge) {
+			down = append(down, fmt.Sprintf("%v (last ping %v seconds ago)", host.Name(), int(age.Seconds())))
+		}
+	}
+
+	check.AddPerfDatum("config_servers", "", float64(len(configHosts)))
+	check.AddPerfDatum("config_servers_down", "", float64(len(down)))
+
+	if len(down) > 0 {
+		check.AddResultf(nagiosplugin.CRITICAL, "%v of %v config servers are not reporting: %v", len(down), len(configHosts), strings.Join(down, ", "))
+		return
+	}
+
+	check.AddResultf(nagiosplugin.OK, "All %v config servers are reporting", len(configHosts))
+}
+
+// doShardBalanceCheck checks the number of shards in the cluster behind a
+// mongos against --expect-shards, and how evenly chunks are spread across them
+// against --chunk-skew.
+func doShardBalanceCheck(check *util.Report, api *util.MMSAPI, mongos *model.Host) {
+	if mongos.TypeName != "SHARD_MONGOS" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--expect-shards and --chunk-skew require a mongos host but %v is %v", hostname, mongos.TypeName)
+		return
+	}
+
+	if expectShards > 0 {
+		hosts, err := api.GetAllHosts(groupId)
+		if err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+
+		shards := map[string]bool{}
+		for _, host := range hosts {
+			if host.ParentClusterId == mongos.ClusterId && host.IsShardMember() && !isExcluded(&host) {
+				shards[host.ShardName] = true
+			}
+		}
+
+		check.AddPerfDatum("shards", "", float64(len(shards)))
+		if len(shards) < expectShards {
+			check.AddResultf(nagiosplugin.CRITICAL, "%v shards, expected %v", len(shards), expectShards)
+		} else if len(shards) > expectShards {
+			check.AddResultf(nagiosplugin.WARNING, "%v shards, expected %v", len(shards), expectShards)
+		} else {
+			check.AddResultf(nagiosplugin.OK, "%v shards", len(shards))
+		}
+	}
+
+	if chunkSkew > 0 {
+		doChunkSkewCheck(check, api, mongos)
+	}
+}
+
+func doChunkSkewCheck(check *util.Report, api *util.MMSAPI, mongos *model.Host) {
+	shards, err := api.GetShardChunks(groupId, mongos.ClusterId)
+	if util.IsNotFound(err) {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Chunk counts are not available on this server (version %v)", defaultString(api.ServerVersion(), "unknown"))
+		return
+	}
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	if len(shards) == 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "No chunk counts found for the cluster behind %v", hostname)
+		return
+	}
+
+	most, least, total := shards[0], shards[0], 0
+	for _, shard := range shards {
+		total += shard.Chunks
+		if shard.Chunks > most.Chunks {
+			most = shard
+		}
+		if shard.Chunks < least.Chunks {
+			least = shard
+		}
+		check.AddPerfDatum(util.SanitizeLabel(shard.ShardName)+"_chunks", "", float64(shard.Chunks))
+	}
+
+	skew := 0.0
+	if total > 0 {
+		average := float64(total) / float64(len(shards))
+		skew = float64(most.Chunks-least.Chunks) / average * 100
+	}
+	check.AddPerfDatum("chunk_skew", "%", skew)
+
+	message := fmt.Sprintf("Chunk skew is %.1f%%, most loaded %v with %v chunks, least loaded %v with %v chunks", skew, most.ShardName, most.Chunks, least.ShardName, least.Chunks)
+	if skew > chunkSkew {
+		check.AddResult(nagiosplugin.WARNING, message)
+	} else {
+		check.AddResult(nagiosplugin.OK, message)
+	}
+}
+
+// doTargetChecks runs the selected check concurrently against each host and
+// merges their reports. A target that fails, or even panics, only affects its
+// own result, so the perfdata of the targets that succeeded is still emitted
+// when the overall status is UNKNOWN.
+func doTargetChecks(check *util.Report, api *util.MMSAPI, opts *checkOptions, hosts []model.Host) {
+	reports := runTargets(api, hosts, func(i int, api *util.MMSAPI, report *util.Report) {
+		doChecks(report, api, opts, &hosts[i])
+	})
+
+	if minHealthyPercent <= 0 {
+		for i, report := range reports {
+			check.Merge(hosts[i].Name(), report)
+		}
+		return
+	}
+
+	// The status comes from the share of healthy hosts rather than the worst
+	// host, so the results of the hosts are only kept as long output.
+	targets := util.NewReport()
+	healthy := 0
+	for i, report := range reports {
+		targets.Merge(hosts[i].Name(), report)
+		if report.ExitStatus() == nagiosplugin.OK {
+			healthy++
+		}
+	}
+
+	check.PerfData = append(check.PerfData, targets.PerfData...)
+	check.Series = append(check.Series, targets.Series...)
+	check.Groups = append(check.Groups, targets.Groups...)
+
+	percent := float64(healthy) / float64(len(hosts)) * 100
+	check.AddPerfDatum("healthy_percent", "%", percent)
+	message := fmt.Sprintf("%v of %v hosts healthy (%.1f%%)", healthy, len(hosts), percent)
+
+	switch {
+	case percent < criticalHealthyPercent:
+		check.AddResult(nagiosplugin.CRITICAL, message)
+	case percent < minHealthyPercent:
+		check.AddResult(nagiosplugin.WARNING, message)
+	default:
+		check.AddResult(nagiosplugin.OK, message)
+	}
+}
+
+// doAggregateChecks fetches the metric concurrently from each host and
+// thresholds a single figure combined with the --host-aggregation function,
+// rather than the worst of the individual results.
+func doAggregateChecks(check *util.Report, api *util.MMSAPI, opts *checkOptions, hosts []model.Host) {
+	if opts.metricName == "" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--host-aggregation %v requires a metric", opts.hostAggregation)
+		return
+	}
+
+	metrics := make([]*model.Metric, len(hosts))
+	indexes := make([]int, len(hosts))
+	reports := runTargets(api, hosts, func(i int, api *util.MMSAPI, report *util.Report) {
+		metrics[i], indexes[i], _ = fetchMetric(report, api, opts, &hosts[i])
+	})
+
+	var values []float64
+	units := ""
+	for i, report := range reports {
+		if metrics[i] == nil {
+			check.Merge(hosts[i].Name(), report)
+			continue
+		}
+
+		value := metrics[i].DataPoints[indexes[i]].Value
+		values = append(values, value)
+		units = metrics[i].Units
+		check.AddPerfDatum(fmt.Sprintf("%v_%v", util.SanitizeLabel(hosts[i].Name()), opts.metricName), "", value)
+	}
+
+	if len(values) == 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "No values of %v found to aggregate", opts.metricName)
+		return
+	}
+
+	aggregate, err := util.Aggregate(opts.hostAggregation, values)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	check.AddPerfDatum(fmt.Sprintf("%v_%v", opts.hostAggregation, opts.metricName), "", aggregate)
+
+	message := fmt.Sprintf("%v of %v across %v hosts is %v", opts.hostAggregation, opts.metricName, len(values), model.FormatValue(aggregate, units))
+	if thresholdPerHost {
+		message = fmt.Sprintf("%v (thresholds per host x %v hosts: warning %v, critical %v)", message, len(values), scaledRange(opts, opts.warning, units, len(values)), scaledRange(opts, opts.critical, units, len(values)))
+		checkScaledThresholds(check, opts, aggregate, units, float64(len(values)), message)
+		return
+	}
+
+	checkThresholds(check, opts, aggregate, units, message)
+}
+
+// scaledRange describes a threshold range multiplied by the number of hosts.
+func scaledRange(opts *checkOptions, rangeStr string, units string, hosts int) string {
+	if opts.steppedThresholds != "" {
+		return "see --thresholds"
+	}
+
+	scaled, err := util.ScaleRange(rangeStr, units, float64(hosts))
+	if err != nil {
+		return rangeStr
+	}
+
+	return scaled
+}
+
+// runTargets runs fn concurrently for each host, passing the host's index, the
+// API to use for it, and a report of its own. It returns the reports in the
+// order of hosts. The requests of targets still running at the --max-runtime
+// deadline are cancelled, and their reports keep the perfdata they gathered
+// before it, marked UNKNOWN, so that a partial outage does not cost it.
+func runTargets(api *util.MMSAPI, hosts []model.Host, fn func(i int, api *util.MMSAPI, report *util.Report)) []*util.Report {
+	ctx, cancel := context.WithCancel(api.Context())
+	defer cancel()
+	api = api.WithContext(ctx)
+
+	reports := make([]*util.Report, len(hosts))
+	done := make([]chan bool, len(hosts))
+	for i := range hosts {
+		reports[i] = util.NewReport()
+		done[i] = make(chan bool)
+		go func(i int, report *util.Report, done chan bool) {
+			defer close(done)
+			runTarget(report, api, func(api *util.MMSAPI, report *util.Report) {
+				fn(i, api, report)
+			})
+		}(i, reports[i], done[i])
+	}
+
+	// Without a --max-runtime deadline the timeout channel stays nil and
+	// every target is waited for.
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timeout = time.After(time.Until(deadline))
+	}
+
+	expired := false
+	for i := range reports {
+		if !expired {
+			select {
+			case <-done[i]:
+			case <-timeout:
+				expired = true
+				cancel()
+			}
+		}
+
+		select {
+		case <-done[i]:
+		default:
+			<-done[i]
+			reports[i] = cutOff(reports[i], "check did not complete within the maximum runtime")
+		}
+	}
+
+	return reports
+}
+
+// runTarget runs fn for a single target. With --per-target-timeout, a target
+// that is still running when it expires is reported as UNKNOWN on its own,
+// so that one slow host does not use up the time of the others. Its requests
+// are then cancelled, and it is waited for so that it no longer runs once
+// runTarget returns. The perfdata it gathered before then is kept.
+func runTarget(check *util.Report, api *util.MMSAPI, fn func(api *util.MMSAPI, report *util.Report)) {
+	ctx, cancel := context.WithCancel(api.Context())
+	defer cancel()
+
+	report := util.NewReport()
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				report.AddResultf(nagiosplugin.UNKNOWN, "check panicked: %v", r)
+			}
+		}()
+		fn(api.WithContext(ctx), report)
+	}()
+
+	// Without a per-target timeout the timeout channel stays nil and the
+	// target is waited for.
+	var timeout <-chan time.Time
+	if perTargetTimeout > 0 {
+		timeout = time.After(time.Duration(perTargetTimeout) * time.Second)
+	}
+
+	select {
+	case <-done:
+		*check = *report
+	case <-timeout:
+		cancel()
+		<-done
+		*check = *cutOff(report, "Check did not complete within the per-target timeout of %v seconds", perTargetTimeout)
+	}
+}
+
+// cutOff returns the perfdata and series a target gathered before it was cut
+// off, with an UNKNOWN result saying why. Its own results are dropped, as they
+// are mostly the errors of the requests that were cancelled.
+func cutOff(report *util.Report, format string, v ...interface{}) *util.Report {
+	partial := util.NewReport()
+	partial.PerfData = report.PerfData
+	partial.Series = report.Series
+	partial.AddResultf(nagiosplugin.UNKNOWN, format, v...)
+
+	return partial
+}
+
+func doHostCheck(check *util.Report, opts *checkOptions, host *model.Host) {
+	if host.MonitoringDisabled() {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Monitoring is disabled for %v", host.Name())
+		return
+	}
+
+	// A member that unexpectedly became primary, or stopped being one, is
+	// critical however recently it was seen.
+	if expectType != "" {
+		if host.TypeName != expectType {
+			check.AddResultf(nagiosplugin.CRITICAL, "%v is %v, expected %v", host.Name(), host.TypeName, expectType)
+		} else {
+			check.AddResultf(nagiosplugin.OK, "%v is %v", host.Name(), host.TypeName)
+		}
+	}
+
+	age := time.Since(host.LastPing)
+
+	if ignoreHidden(host) {
+		check.AddResultf(nagiosplugin.OK, "Last ping was %v seconds ago on hidden member, ignoring", age.Seconds())
+		return
+	}
+
+	observe(check, opts, "", age.Seconds(), age)
+	checkThresholds(check, opts, age.Seconds(), "", fmt.Sprintf("Last ping was %v seconds ago", age.Seconds()))
+}
+
+// observe records the value a single target check compares with the
+// thresholds, and how old it is, for the JSON output.
+func observe(check *util.Report, opts *checkOptions, metric string, value float64, age time.Duration) {
+	observation := &util.Observation{Metric: metric, Value: value, Age: age}
+	if opts.steppedThresholds != "" {
+		observation.Thresholds = opts.steppedThresholds
+	} else {
+		observation.Warning, observation.Critical = opts.warning, opts.critical
+	}
+
+	check.Observation = observation
+}
+
+// doMetricCheck checks every metric of a comma separated --metric list in
+// turn. The worst of them decides the status, and each result names its
+// metric so that the summary says which one breached.
+func doMetricCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	names := strings.Split(opts.metricName, ",")
+	if len(names) == 1 {
+		doSingleMetricCheck(check, api, opts, host)
+		return
+	}
+
+	for _, name := range names {
+		metricOpts := *opts
+		metricOpts.metricName = strings.TrimSpace(name)
+
+		report := util.NewReport()
+		doSingleMetricCheck(report, api, &metricOpts, host)
+		for i := range report.Results {
+			report.Results[i].Message = fmt.Sprintf("%v: %v", metricOpts.metricName, report.Results[i].Message)
+		}
+		check.Append(report)
+	}
+}
+
+func doSingleMetricCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	if dumpRaw {
+		doDumpRaw(check, api, opts, host)
+		return
+	}
+
+	metric, lastIndex, ok := fetchMetric(check, api, opts, host)
+	if ok == false {
+		return
+	}
+	lastDataPoint := metric.DataPoints[lastIndex]
+
+	unit, scale := util.PerfUnit(metric.Units)
+	if detectCounters {
+		metricType, err := util.ClassifyMetric(api, cache, groupId, host.Id, opts.metricName)
+		if err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+
+		if metricType == util.MetricTypeCounter {
+			unit, scale = "c", 1
+		}
+	}
+
+	if override, ok := unitOverrides[opts.metricName]; ok {
+		unit, scale = override, 1
+	}
+
+	// The thresholds go with the value they are compared with.
+	if function == "last" {
+		check.AddPerfDatum(opts.metricName, unit, lastDataPoint.Value*scale, perfThresholds(opts, metric, scale)...)
+	} else {
+		check.AddPerfDatum(opts.metricName, unit, lastDataPoint.Value*scale)
+	}
+
+	if perfDataAll {
+		addPerfDataAll(check, opts, metric, unit, scale)
+	} else if hasOutput("csv") || hasOutput("influx-lp") || hasOutput("otlp") {
+		check.AddSeries(opts.metricName, metric.DataPoints)
+	}
+
+	if function != "last" {
+		value, err := util.Aggregate(function, metric.Values())
+		if err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return
+		}
+
+		check.AddPerfDatum(fmt.Sprintf("%v_%v", opts.metricName, function), unit, value*scale, perfThresholds(opts, metric, scale)...)
+		observe(check, opts, opts.metricName, value, time.Since(lastDataPoint.Timestamp))
+		checkThresholds(check, opts, value, metric.Units, fmt.Sprintf("%v of %v over %v is %v (last %v)", function, opts.metricName, period, model.FormatValue(value, metric.Units), model.FormatValue(lastDataPoint.Value, metric.Units)))
+		return
+	}
+
+	observe(check, opts, opts.metricName, lastDataPoint.Value, time.Since(lastDataPoint.Timestamp))
+	checkThresholds(check, opts, lastDataPoint.Value, metric.Units, metric.ToStringDataPoint(lastIndex))
+}
+
+// doDumpRaw prints the raw response body of the metric request to stderr,
+// with the API key redacted, instead of evaluating it.
+func doDumpRaw(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	body, err := api.GetHostMetricBody(groupId, host.Id, opts.metricName, opts.dbName, granularity, period)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	raw := string(body)
+	if apiKey != "" {
+		raw = strings.Replace(raw, apiKey, "REDACTED", -1)
+	}
+
+	fmt.Fprintln(os.Stderr, raw)
+	check.AddResultf(nagiosplugin.OK, "Dumped %v bytes of raw response for %v", len(body), opts.metricName)
+}
+
+// doIncreaseCheck thresholds how much a counter metric went up over the
+// period, e.g. the number of elections, rather than its current value.
+func doIncreaseCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host, what string) {
+	metric, _, ok := fetchMetric(check, api, opts, host)
+	if ok == false {
+		return
+	}
+
+	increase := metric.Increase()
+	check.AddPerfDatum(what, "", increase)
+	message := fmt.Sprintf("%v %v in the last %v", increase, what, period)
+
+	// The rate is divided by the time between the data points, which is not
+	// always an exact multiple of the granularity.
+	if rate, regular := metric.Rate(); rate > 0 {
+		check.AddPerfDatum(what+"_per_second", "", rate)
+		if regular == false {
+			message = fmt.Sprintf("%v (irregular sampling)", message)
+		}
+	}
+
+	checkThresholds(check, opts, increase, "", message)
+}
+
+// doAssertionCheck thresholds the number of assertions of the --assertion-type
+// raised over the period, summed across the assertion counters it covers.
+func doAssertionCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	total := 0.0
+	for _, name := range assertionMetrics[assertionType] {
+		metric, _, ok := fetchNamedMetric(check, api, opts, host, name)
+		if ok == false {
+			return
+		}
+
+		increase := metric.Increase()
+		check.AddPerfDatum(name, "c", increase)
+		total += increase
+	}
+
+	checkThresholds(check, opts, total, "", fmt.Sprintf("%v %v assertions in the last %v", total, assertionType, period))
+}
+
+// doRateSinceLastRunCheck thresholds the per second rate of a counter metric
+// since the value seen by the previous run, which is kept in the cache file,
+// so that the rate covers the whole time between runs however short --period.
+func doRateSinceLastRunCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	metric, index, ok := fetchMetric(check, api, opts, host)
+	if ok == false {
+		return
+	}
+
+	key := fmt.Sprintf("lastRun/%v/%v/%v/%v", groupId, host.Id, opts.metricName, opts.dbName)
+	rate, elapsed, ok, err := util.RateSinceLastRun(cache, key, metric.DataPoints[index])
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	if ok == false {
+		check.AddResultf(nagiosplugin.OK, "No earlier value of %v to compare with yet, the rate is reported from the next new data point", opts.metricName)
+		return
+	}
+
+	check.AddPerfDatum(opts.metricName+"_per_second", "", rate)
+
+	checkThresholds(check, opts, rate, metric.Units, fmt.Sprintf("%v went up by %v per second over the last %v seconds", opts.metricName, rate, int(elapsed.Seconds())))
+}
+
+// doRateCheck thresholds the per second rate of change between the last two
+// data points, for cumulative counters whose absolute value means nothing.
+func doRateCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	metric, index, ok := fetchMetric(check, api, opts, host)
+	if ok == false {
+		return
+	}
+
+	previous := index - 1
+	for previous >= 0 && metric.DataPoints[previous].Null {
+		previous--
+	}
+	if previous < 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Only one data point of %v over %v, at least two are needed for a rate", opts.metricName, period)
+		return
+	}
+
+	// The rate of the last two data points alone, where a counter reset
+	// counts as no change, as it does for the whole period.
+	last := *metric
+	last.DataPoints = []model.DataPoint{metric.DataPoints[previous], metric.DataPoints[index]}
+	rate, _ := last.Rate()
+
+	// Nagios has no unit for a rate, so it is reported without one, in bytes
+	// or seconds per second for metrics measured in them.
+	_, scale := util.PerfUnit(metric.Units)
+	check.AddPerfDatum(opts.metricName+"_per_second", "", rate*scale)
+
+	observe(check, opts, opts.metricName, rate, time.Since(metric.DataPoints[index].Timestamp))
+	checkThresholds(check, opts, rate, metric.Units, fmt.Sprintf("%v changed by %v per second between the last two data points", opts.metricName, rate))
+}
+
+// doEnvelopeCheck reports the minimum, maximum and current value of the metric
+// over the period, and thresholds the current value as a percent of the
+// maximum, i.e. how close it is to the historical peak.
+func doEnvelopeCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	metric, index, ok := fetchMetric(check, api, opts, host)
+	if ok == false {
+		return
+	}
+
+	values := metric.Values()
+	minimum, _ := util.Aggregate("min", values)
+	maximum, _ := util.Aggregate("max", values)
+	current := metric.DataPoints[index].Value
+
+	check.AddPerfDatum(opts.metricName+"_min", "", minimum)
+	check.AddPerfDatum(opts.metricName+"_max", "", maximum)
+	check.AddPerfDatum(opts.metricName, "", current, minimum, maximum)
+
+	if maximum <= 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Cannot compare %v with a peak of %v over %v", opts.metricName, maximum, period)
+		return
+	}
+
+	percent := current / maximum * 100
+	check.AddPerfDatum(opts.metricName+"_percent_of_max", "%", percent)
+
+	checkThresholds(check, opts, percent, "PERCENT", fmt.Sprintf("%v is %v, %.1f%% of its peak of %v over %v (low %v)", opts.metricName, model.FormatValue(current, metric.Units), percent, model.FormatValue(maximum, metric.Units), period, model.FormatValue(minimum, metric.Units)))
+}
+
+// doSummaryCheck reports the min, avg, max and last value of the metric over
+// the period, thresholding the one chosen with --summarize-threshold.
+func doSummaryCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	metric, index, ok := fetchMetric(check, api, opts, host)
+	if ok == false {
+		return
+	}
+
+	values := metric.Values()
+	summary := map[string]float64{"last": metric.DataPoints[index].Value}
+	for _, function := range []string{"min", "avg", "max"} {
+		summary[function], _ = util.Aggregate(function, values)
+	}
+
+	var parts []string
+	for _, function := range []string{"min", "avg", "max", "last"} {
+		check.AddPerfDatum(fmt.Sprintf("%v_%v", opts.metricName, function), "", summary[function])
+		parts = append(parts, fmt.Sprintf("%v %v", function, model.FormatValue(summary[function], metric.Units)))
+	}
+
+	checkThresholds(check, opts, summary[summarizeThreshold], metric.Units, fmt.Sprintf("%v over %v: %v", opts.metricName, period, strings.Join(parts, ", ")))
+}
+
+// doZScoreCheck thresholds how many standard deviations the last value is from
+// the mean of the earlier values of the period, flagging outliers whatever
+// the usual level of the metric.
+func doZScoreCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	metric, index, ok := fetchMetric(check, api, opts, host)
+	if ok == false {
+		return
+	}
+
+	baseline := &model.Metric{DataPoints: metric.DataPoints[:index]}
+	values := baseline.Values()
+	if len(values) < 3 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Only %v earlier data points of %v over %v, too few for a baseline", len(values), opts.metricName, period)
+		return
+	}
+
+	mean, stdDev, _ := util.MeanStdDev(values)
+	if stdDev == 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v did not vary over %v, so there is no baseline to compare with", opts.metricName, period)
+		return
+	}
+
+	current := metric.DataPoints[index].Value
+	z := (current - mean) / stdDev
+	check.AddPerfDatum(opts.metricName, "", current)
+	check.AddPerfDatum(opts.metricName+"_zscore", "", z)
+
+	checkThresholds(check, opts, z, "", fmt.Sprintf("%v is %v, %.2f standard deviations from its mean of %v over %v", opts.metricName, model.FormatValue(current, metric.Units), z, model.FormatValue(mean, metric.Units), period))
+}
+
+// reportsMetric checks that the host reports the named metric at all, so that
+// curated checks can explain why it is missing. If it does not, it adds an
+// UNKNOWN result ending with hint and returns false.
+func reportsMetric(check *util.Report, api *util.MMSAPI, host *model.Host, name string, hint string) bool {
+	metrics, err := api.GetHostMetrics(groupId, host.Id)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return false
+	}
+
+	for _, metric := range metrics {
+		if metric.MetricName == name {
+			return true
+		}
+	}
+
+	check.AddResultf(nagiosplugin.UNKNOWN, "%v does not report %v. %v", host.Name(), name, hint)
+	return false
+}
+
+// doGlobalLockCheck thresholds the percent of time the global lock was held,
+// which only MMAPv1 era servers report.
+func doGlobalLockCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	if reportsMetric(check, api, host, GlobalLockMetric, "The global lock percentage is only reported by MMAPv1 servers before MongoDB 3.2") == false {
+		return
+	}
+
+	metric, index, ok := fetchNamedMetric(check, api, opts, host, GlobalLockMetric)
+	if ok == false {
+		return
+	}
+
+	value := metric.DataPoints[index].Value
+	check.AddPerfDatum("global_lock", "%", value)
+
+	checkThresholds(check, opts, value, "PERCENT", fmt.Sprintf("Global lock held %.1f%% of the time", value))
+}
+
+// doCursorsCheck thresholds the number of open cursors, and reports how many
+// cursors timed out over the period when the host reports it.
+func doCursorsCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	metric, index, ok := fetchNamedMetric(check, api, opts, host, CursorsOpenMetric)
+	if ok == false {
+		return
+	}
+
+	open := metric.DataPoints[index].Value
+	check.AddPerfDatum("cursors_open", "", open)
+	message := fmt.Sprintf("%v open cursors", open)
+
+	if timedOut, err := api.GetHostMetric(groupId, host.Id, CursorsTimedOutMetric, granularity, period); err == nil {
+		increase := timedOut.Increase()
+		check.AddPerfDatum("cursors_timed_out", "", increase)
+		message = fmt.Sprintf("%v, %v timed out in the last %v", message, increase, period)
+	}
+
+	checkThresholds(check, opts, open, "", message)
+}
+
+// doOplogChurnCheck thresholds the rate at which the oplog is written in GB
+// per hour. With --oplog-size it also reports the oplog window that rate
+// leaves, which shrinks long before the window check itself notices.
+func doOplogChurnCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	if reportsMetric(check, api, host, OplogRateMetric, "Is it a replica set member?") == false {
+		return
+	}
+
+	metric, index, ok := fetchNamedMetric(check, api, opts, host, OplogRateMetric)
+	if ok == false {
+		return
+	}
+
+	rate := metric.DataPoints[index].Value
+	check.AddPerfDatum("oplog_churn", "", rate)
+	message := fmt.Sprintf("Oplog churn of %.2f GB/hour", rate)
+
+	if oplogSize != "" {
+		size, err := util.ParseValue(oplogSize, "GIGABYTES")
+		if err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing oplog size. Error: %v", err)
+			return
+		}
+
+		if rate > 0 {
+			hours := size / rate
+			check.AddPerfDatum("projected_window", "", hours)
+			message = fmt.Sprintf("%v, a projected oplog window of %.1f hours", message, hours)
+		}
+	}
+
+	checkThresholds(check, opts, rate, "", message)
+}
+
+// doScanRatioCheck thresholds the number of documents scanned for each one
+// returned. A high ratio means queries are not served by an index.
+func doScanRatioCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	if reportsMetric(check, api, host, ScannedObjectsMetric, "Is it a mongod?") == false || reportsMetric(check, api, host, ReturnedDocsMetric, "Is it a mongod?") == false {
+		return
+	}
+
+	scannedMetric, scannedIndex, ok := fetchNamedMetric(check, api, opts, host, ScannedObjectsMetric)
+	if ok == false {
+		return
+	}
+
+	returnedMetric, returnedIndex, ok := fetchNamedMetric(check, api, opts, host, ReturnedDocsMetric)
+	if ok == false {
+		return
+	}
+
+	scanned := scannedMetric.DataPoints[scannedIndex].Value
+	returned := returnedMetric.DataPoints[returnedIndex].Value
+	check.AddPerfDatum("scanned", "", scanned)
+	check.AddPerfDatum("returned", "", returned)
+
+	// Without any documents returned there is no ratio to speak of, as on a
+	// host that only takes writes.
+	if returned == 0 {
+		check.AddResultf(nagiosplugin.OK, "%v documents scanned and none returned", scanned)
+		return
+	}
+
+	ratio := scanned / returned
+	check.AddPerfDatum("scan_ratio", "", ratio)
+	checkThresholds(check, opts, ratio, "", fmt.Sprintf("%.1f documents scanned per document returned (%v scanned, %v returned)", ratio, scanned, returned))
+}
+
+// doDatabaseCountCheck thresholds the number of databases on the host, as a
+// guard against runaway database creation, and names the largest of them.
+func doDatabaseCountCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	databases, err := api.GetHostDatabases(groupId, host.Id)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	count := len(databases)
+	check.AddPerfDatum("databases", "", float64(count))
+	message := fmt.Sprintf("%v databases", count)
+
+	// A database whose size cannot be fetched is left out of the largest.
+	sizes := make([]float64, count)
+	var wg sync.WaitGroup
+	slots := make(chan bool, concurrency)
+	for i, database := range databases {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			slots <- true
+			defer func() { <-slots }()
+
+			metric, err := api.GetHostDBMetric(groupId, host.Id, DBStorageMetric, name, granularity, period)
+			if err != nil {
+				return
+			}
+			if index := metric.LastNonNullIndex(); index >= 0 {
+				sizes[i] = metric.DataPoints[index].Value
+			}
+		}(i, database.DatabaseName)
+	}
+	wg.Wait()
+
+	order := make([]int, count)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return sizes[order[a]] > sizes[order[b]] })
+
+	var largest []string
+	for _, i := range order {
+		if len(largest) == 3 || sizes[i] == 0 {
+			break
+		}
+		largest = append(largest, fmt.Sprintf("%v (%v)", databases[i].DatabaseName, model.FormatValue(sizes[i], "BYTES")))
+	}
+	if len(largest) > 0 {
+		message = fmt.Sprintf("%v, largest %v", message, strings.Join(largest, ", "))
+	}
+
+	checkThresholds(check, opts, float64(count), "", message)
+}
+
+// doWiredTigerCheck thresholds the dirty or used bytes of the WiredTiger cache
+// as a percent of --cache-size, or the rate at which data is evicted from it.
+func doWiredTigerCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	name := wiredTigerMetrics[wiredTiger]
+	if reportsMetric(check, api, host, name, "Is its storage engine WiredTiger?") == false {
+		return
+	}
+
+	if wiredTiger == "eviction" {
+		metric, _, ok := fetchNamedMetric(check, api, opts, host, name)
+		if ok == false {
+			return
+		}
+
+		if values := len(metric.Values()); values < 2 {
+			check.AddResultf(nagiosplugin.UNKNOWN, "Only %v data points of %v over %v, at least two are needed for a rate", values, name, period)
+			return
+		}
+
+		// Nagios has no unit for a rate, so it is reported in bytes per
+		// second without one.
+		rate, regular := metric.Rate()
+		_, scale := util.PerfUnit(metric.Units)
+		check.AddPerfDatum("cache_evicted", "", rate*scale)
+
+		message := fmt.Sprintf("%v per second evicted from the WiredTiger cache", model.FormatValue(rate, metric.Units))
+		if regular == false {
+			message = fmt.Sprintf("%v (irregular sampling)", message)
+		}
+		checkThresholds(check, opts, rate, metric.Units, message)
+		return
+	}
+
+	if cacheSize == "" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "--wiredtiger %v requires --cache-size", wiredTiger)
+		return
+	}
+
+	metric, index, ok := fetchNamedMetric(check, api, opts, host, name)
+	if ok == false {
+		return
+	}
+
+	size, err := util.ParseValue(cacheSize, metric.Units)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing cache size. Error: %v", err)
+		return
+	}
+
+	if size <= 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Cache size must be greater than zero")
+		return
+	}
+
+	value := metric.DataPoints[index].Value
+	percent := value / size * 100
+	unit, scale := util.PerfUnit(metric.Units)
+	check.AddPerfDatum(fmt.Sprintf("cache_%v", wiredTiger), unit, value*scale)
+	check.AddPerfDatum(fmt.Sprintf("cache_%v_percent", wiredTiger), "%", percent)
+
+	checkThresholds(check, opts, percent, "PERCENT", fmt.Sprintf("WiredTiger cache is %.1f%% %v", percent, wiredTiger))
+}
+
+// fetchMetric fetches the metric for host and picks the data point to check.
+// When there is no usable, fresh data point it adds a result explaining why
+// and returns false.
+func fetchMetric(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) (*model.Metric, int, bool) {
+	return fetchNamedMetric(check, api, opts, host, opts.metricName)
+}
+
+// fetchNamedMetric is fetchMetric for a metric other than --metric.
+func fetchNamedMetric(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host, name string) (*model.Metric, int, bool) {
+	// Without monitoring there are no data points, which would otherwise
+	// look like a stale or missing metric.
+	if host.MonitoringDisabled() {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Monitoring is disabled for %v", host.Name())
+		return nil, 0, false
+	}
+
+	var metric *model.Metric
+	var err error
+	if opts.dbName == "" {
+		metric, err = api.GetHostMetric(groupId, host.Id, name, granularity, period)
+	} else {
+		metric, err = api.GetHostDBMetric(groupId, host.Id, name, opts.dbName, granularity, period)
+	}
+
+	if util.IsNotFound(err) {
+		// The host may have been removed since the topology was cached.
+		invalidateTopology()
+
+		// A member removed from the deployment since the hosts were
+		// listed is not a problem with the metric.
+		if _, err := api.GetHost(groupId, host.Id); util.IsNotFound(err) {
+			check.AddResultf(nagiosplugin.OK, "%v was removed during the check", host.Name())
+			return nil, 0, false
+		}
+
+		check.AddResultf(nagiosplugin.UNKNOWN, "Metric %v is not available for this host or MMS/Ops Manager version", name)
+		return nil, 0, false
+	}
+
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return nil, 0, false
+	}
+
+	if len(metric.DataPoints) == 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "No data points found for %v", name)
+		return nil, 0, false
+	}
+
+	if valueField != "" {
+		if err := metric.SelectField(valueField); err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+			return nil, 0, false
+		}
+	} else if fields := metric.FieldNames(); fields != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Data points of %v have the sub-values %v. Choose one with --value-field", name, strings.Join(fields, " "))
+		return nil, 0, false
+	}
+
+	lastIndex := len(metric.DataPoints) - 1
+	if metric.DataPoints[lastIndex].Null {
+		switch nullPolicy {
+		case "skip":
+			lastIndex = metric.LastNonNullIndex()
+			if lastIndex < 0 {
+				check.AddResultf(nagiosplugin.UNKNOWN, "No data points with a value found for %v", name)
+				return nil, 0, false
+			}
+		case "unknown":
+			check.AddResultf(nagiosplugin.UNKNOWN, "Last data point for %v has no value", name)
+			return nil, 0, false
+		}
+	}
+
+	// Some metrics are batched with timestamps aligned to the granularity,
+	// so the last ping of the host can be the better sign of fresh data.
+	what := fmt.Sprintf("Last data point for %v", name)
+	age := time.Since(metric.DataPoints[lastIndex].Timestamp)
+	if stalenessSource == "lastping" {
+		what = fmt.Sprintf("Last ping of %v", host.Name())
+		age = time.Since(host.LastPing)
+	}
+
+	if int(age.Seconds()) > maxAge {
+		if ignoreHidden(host) {
+			check.AddResultf(nagiosplugin.OK, "%v is %v seconds old on hidden member, ignoring.", what, int(age.Seconds()))
+			return nil, 0, false
+		}
+
+		check.AddResultf(policyStatuses[staleStatus], "%v is %v seconds old.", what, int(age.Seconds()))
+		return nil, 0, false
+	}
+
+	return metric, lastIndex, true
+}
+
+// doGrowthCheck compares the metric now with its value one period ago and
+// thresholds the absolute or percent growth, projecting when --capacity will
+// be reached at the current rate.
+func doGrowthCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	metric, index, ok := fetchMetric(check, api, opts, host)
+	if ok == false {
+		return
+	}
+	current := metric.DataPoints[index]
+
+	window, err := util.ParsePeriod(period)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	end := current.Timestamp.Add(-window)
+	previousMetric, err := api.GetHostMetricRange(groupId, host.Id, opts.metricName, opts.dbName, granularity, end.Add(-window), end)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	previousIndex := previousMetric.LastNonNullIndex()
+	if previousIndex < 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "No data points found for %v one period ago", opts.metricName)
+		return
+	}
+	previous := previousMetric.DataPoints[previousIndex]
+
+	change := current.Sub(previous)
+	check.AddPerfDatum("growth", "", change)
+	message := fmt.Sprintf("%v grew by %v over %v", opts.metricName, model.FormatValue(change, metric.Units), period)
+
+	value := change
+	units := metric.Units
+	if previous.Value != 0 {
+		percent := change / previous.Value * 100
+		check.AddPerfDatum("growth_percent", "%", percent)
+		message = fmt.Sprintf("%v (%.1f%%)", message, percent)
+		if growth == "percent" {
+			value = percent
+			units = "PERCENT"
+		}
+	} else if growth == "percent" {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Cannot compute percent growth of %v from zero", opts.metricName)
+		return
+	}
+
+	if capacity != "" {
+		capacityValue, err := util.ParseValue(capacity, metric.Units)
+		if err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing capacity. Error: %v", err)
+			return
+		}
+
+		rate := change / current.Timestamp.Sub(previous.Timestamp).Seconds()
+		if rate > 0 {
+			days := (capacityValue - current.Value) / rate / (24 * 60 * 60)
+			check.AddPerfDatum("days_to_full", "", days)
+			message = fmt.Sprintf("%v, capacity reached in %.1f days at this rate", message, days)
+		}
+	}
+
+	checkThresholds(check, opts, value, units, message)
+}
+
+func doAgentErrorCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions, host *model.Host) {
+	pattern, err := regexp.Compile(agentPattern)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing pattern. Error: %v", err)
+		return
+	}
+
+	window, err := util.ParsePeriod(period)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	entries, err := api.GetAgentLog(groupId, host.Id, agentType)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	count := 0
+	lastMessage := ""
+	for _, entry := range entries {
+		if time.Since(entry.Timestamp) > window || !entry.IsError() || !pattern.MatchString(entry.Message) {
+			continue
+		}
+		count++
+		lastMessage = entry.Message
+	}
+
+	check.AddPerfDatum("agent_errors", "", float64(count))
+
+	message := fmt.Sprintf("%v %v agent errors in the last %v", count, agentType, period)
+	if count > 0 {
+		message = fmt.Sprintf("%v. Last error: %v", message, lastMessage)
+	}
+
+	checkThresholds(check, opts, float64(count), "", message)
+}
+
+// doAlertsCheck is critical while Ops Manager has an open alert for the host,
+// such as HOST_DOWN, for conditions it already evaluates itself.
+func doAlertsCheck(check *util.Report, api *util.MMSAPI, host *model.Host) {
+	alerts, err := api.GetOpenAlerts(groupId)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	var eventTypes []string
+	for _, alert := range alerts {
+		if alert.HostId == host.Id {
+			eventTypes = append(eventTypes, alert.EventTypeName)
+		}
+	}
+
+	check.AddPerfDatum("open_alerts", "", float64(len(eventTypes)))
+
+	if len(eventTypes) == 0 {
+		check.AddResultf(nagiosplugin.OK, "No open alerts for %v", host.Name())
+		return
+	}
+
+	check.AddResultf(nagiosplugin.CRITICAL, "%v open alerts for %v: %v", len(eventTypes), host.Name(), strings.Join(eventTypes, ", "))
+}
+
+func doLatencyCheck(check *util.Report, api *util.MMSAPI) {
+	latency, err := api.Ping(groupId)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	check.AddPerfDatum("latency", "s", latency.Seconds())
+	check.AddResultf(nagiosplugin.OK, "API responded in %v seconds", latency.Seconds())
+}
+
+// doTestAuth checks that the configured credentials are accepted, naming the
+// authentication mode tried and the HTTP status of a failure.
+func doTestAuth(check *util.Report, api *util.MMSAPI) {
+	mode := fmt.Sprintf("HTTP digest authentication as %v", username)
+
+	err := api.TestAuth()
+	if apiErr, ok := err.(*util.APIError); ok {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v failed with HTTP status %v: %v", mode, apiErr.StatusCode, apiErr)
+		return
+	}
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v failed: %v", mode, err)
+		return
+	}
+
+	check.AddResultf(nagiosplugin.OK, "%v succeeded against %v", mode, server)
+}
+
+// healthStatuses maps the statuses of the deployment health endpoint to
+// nagios statuses. Anything else is reported as UNKNOWN.
+var healthStatuses = map[string]nagiosplugin.Status{
+	"HEALTHY":   nagiosplugin.OK,
+	"OK":        nagiosplugin.OK,
+	"WARNING":   nagiosplugin.WARNING,
+	"DEGRADED":  nagiosplugin.WARNING,
+	"UNHEALTHY": nagiosplugin.CRITICAL,
+	"CRITICAL":  nagiosplugin.CRITICAL,
+	"DOWN":      nagiosplugin.CRITICAL,
+}
+
+func healthStatus(status string) nagiosplugin.Status {
+	nagiosStatus, ok := healthStatuses[strings.ToUpper(status)]
+	if ok == false {
+		return nagiosplugin.UNKNOWN
+	}
+
+	return nagiosStatus
+}
+
+func doDeploymentCheck(check *util.Report, api *util.MMSAPI) {
+	health, err := api.GetDeploymentHealth(groupId)
+	if util.IsNotFound(err) {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Deployment health is not available on this server (version %v)", defaultString(api.ServerVersion(), "unknown"))
+		return
+	}
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	check.AddResultf(healthStatus(health.Status), "Deployment health is %v", health.Status)
+
+	for _, subsystem := range health.Subsystems {
+		if subsystem.Message != "" {
+			check.AddResultf(healthStatus(subsystem.Status), "%v is %v: %v", subsystem.Name, subsystem.Status, subsystem.Message)
+		} else {
+			check.AddResultf(healthStatus(subsystem.Status), "%v is %v", subsystem.Name, subsystem.Status)
+		}
+	}
+}
+
+// doAutomationDriftCheck thresholds how many versions the process furthest
+// behind lags the goal automation config version, listing every lagging one.
+func doAutomationDriftCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions) {
+	status, err := api.GetAutomationStatus(groupId)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	lagging := status.Lagging()
+	maxLag := 0
+	var names []string
+	for _, process := range lagging {
+		lag := status.GoalVersion - process.LastGoalVersionAchieved
+		if lag > maxLag {
+			maxLag = lag
+		}
+		names = append(names, fmt.Sprintf("%v on %v (version %v)", process.Name, process.Hostname, process.LastGoalVersionAchieved))
+	}
+
+	check.AddPerfDatum("lagging_processes", "", float64(len(lagging)))
+	check.AddPerfDatum("max_version_lag", "", float64(maxLag))
+
+	message := fmt.Sprintf("All %v processes are at goal version %v", len(status.Processes), status.GoalVersion)
+	if len(lagging) > 0 {
+		message = fmt.Sprintf("%v of %v processes are behind goal version %v: %v", len(lagging), len(status.Processes), status.GoalVersion, strings.Join(names, ", "))
+	}
+
+	checkThresholds(check, opts, float64(maxLag), "", message)
+}
+
+// doCertExpiryCheck checks how many days remain until the certificate of the
+// MMS/Ops Manager server expires.
+func doCertExpiryCheck(check *util.Report, api *util.MMSAPI) {
+	// The certificate is read from the TLS handshake alone, so that one that
+	// has expired or is not trusted is reported as such rather than as a
+	// failed request.
+	certificate, err := api.PeerCertificate()
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	days := time.Until(certificate.NotAfter).Hours() / 24
+	check.AddPerfDatum("cert_days_left", "", days)
+	message := fmt.Sprintf("Certificate %v of %v expires in %.1f days on %v", certificate.Subject.CommonName, server, days, certificate.NotAfter.UTC().Format(time.RFC3339))
+
+	switch {
+	case time.Now().After(certificate.NotAfter):
+		check.AddResultf(nagiosplugin.CRITICAL, "Certificate %v of %v expired on %v", certificate.Subject.CommonName, server, certificate.NotAfter.UTC().Format(time.RFC3339))
+	case days < float64(critDays):
+		check.AddResult(nagiosplugin.CRITICAL, message)
+	case days < float64(warnDays):
+		check.AddResult(nagiosplugin.WARNING, message)
+	default:
+		check.AddResult(nagiosplugin.OK, message)
+	}
+}
+
+func doReplicaSetCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions) {
+	hosts, err := api.GetAllHosts(groupId)
+	if err != nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	var members []model.Host
+	var primaries []string
+	for _, host := range hosts {
+		if host.ReplicaSetName != replicaSet || ignoreHidden(&host) || isExcluded(&host) {
+			continue
+		}
+		members = append(members, host)
+		if host.ReplicaStateName == "PRIMARY" {
+			primaries = append(primaries, host.Name())
+		}
+	}
+
+	if len(members) == 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "No members found for replica set %v", replicaSet)
+		return
+	}
+
+	check.AddPerfDatum("members", "", float64(len(members)))
+
+	if len(primaries) == 0 {
+		check.AddResultf(nagiosplugin.CRITICAL, "Replica set %v has no primary", replicaSet)
+	} else {
+		check.AddResultf(nagiosplugin.OK, "Replica set %v has primary %v and %v members", replicaSet, strings.Join(primaries, ", "), len(members))
+	}
+
+	if expectVoters > 0 {
+		doVoterCheck(check, api)
+	}
+
+	if opts.metricName != "" {
+		doTargetChecks(check, api, opts, members)
+	}
+}
 
-func main() {
-	setupFlags()
-	if hostname == "" || groupId == "" {
-		flag.Usage()
-		os.Exit(2)
+// doClusterCheck runs the check against every member of the named replica
+// set or sharded cluster, as found at the time of the check, and reports the
+// worst of them together with the members that are not OK.
+func doClusterCheck(check *util.Report, api *util.MMSAPI, opts *checkOptions) {
+	// Versions without the clusters endpoint can still match the replica set
+	// name of the hosts.
+	clusters, err := api.GetClusters(groupId)
+	if err != nil && !util.IsNotFound(err) {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
 		return
 	}
 
-	check := nagiosplugin.NewCheck()
-	defer check.Finish()
+	clusterIds := map[string]bool{}
+	for _, candidate := range clusters {
+		if candidate.ClusterName == cluster || candidate.ReplicaSetName == cluster {
+			clusterIds[candidate.Id] = true
+		}
+	}
 
-	api, err := util.NewMMSAPI(server, timeout, username, apiKey)
+	hosts, err := api.GetAllHosts(groupId)
 	if err != nil {
-		check.AddResultf(nagiosplugin.UNKNOWN, "Failed to create API. Error: %v", err)
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		return
+	}
+
+	var members []model.Host
+	for _, host := range hosts {
+		inCluster := clusterIds[host.ClusterId] || clusterIds[host.ParentClusterId] || host.ReplicaSetName == cluster
+		if !inCluster || ignoreHidden(&host) || isExcluded(&host) {
+			continue
+		}
+		members = append(members, host)
+	}
+
+	if len(members) == 0 {
+		check.AddResultf(nagiosplugin.UNKNOWN, "No members found for cluster %v", cluster)
+		return
+	}
+
+	check.AddPerfDatum("members", "", float64(len(members)))
+
+	doTargetChecks(check, api, opts, members)
+
+	var lagging []string
+	for _, group := range check.Groups {
+		if group.Status != nagiosplugin.OK {
+			lagging = append(lagging, group.Name)
+		}
+	}
+
+	if len(lagging) == 0 {
+		check.AddResultf(nagiosplugin.OK, "All %v members of %v are OK", len(members), cluster)
 		return
 	}
 
-	host, err := api.GetHostByName(groupId, hostname)
+	state := "lagging"
+	if opts.metricName != "" {
+		state = "not OK"
+	}
+
+	check.AddResultf(check.Status, "%v of %v members of %v are %v: %v", len(lagging), len(members), cluster, state, strings.Join(lagging, ", "))
+}
+
+// doParameterCheck warns when the value a host is running with for a startup
+// option differs from the value in the automation config, which means it was
+// changed by hand behind the back of automation.
+func doParameterCheck(check *util.Report, api *util.MMSAPI, host *model.Host) {
+	config, err := api.GetAutomationConfig(groupId)
 	if err != nil {
 		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
 		return
 	}
 
-	if metricName == "" {
-		doHostCheck(check, host)
-	} else {
-		doMetricCheck(check, api, host)
+	process := config.Process(host.Hostname, host.Port)
+	if process == nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v is not managed by automation", host.Name())
+		return
 	}
-}
 
-func doHostCheck(check *nagiosplugin.Check, host *model.Host) {
-	age := time.Since(host.LastPing)
+	expected, ok := model.LookupOption(process.Args, parameter)
+	if ok == false {
+		check.AddResultf(nagiosplugin.UNKNOWN, "The automation config does not set %v for %v", parameter, host.Name())
+		return
+	}
 
-	critRange, err := nagiosplugin.ParseRange(critical)
+	parameters, err := api.GetHostParameters(groupId, host.Id)
+	if util.IsNotFound(err) {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Effective parameters are not available on this server (version %v)", defaultString(api.ServerVersion(), "unknown"))
+		return
+	}
 	if err != nil {
-		check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing critical range. Error: %v", err)
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
 		return
 	}
 
-	if critRange.Check(age.Seconds()) {
-		check.AddResultf(nagiosplugin.CRITICAL, fmt.Sprintf("Last ping was %v seconds ago", age.Seconds()))
+	actual, ok := model.LookupOption(parameters, parameter)
+	if ok == false {
+		check.AddResultf(nagiosplugin.WARNING, "%v is %v in the automation config but not set on %v", parameter, expected, host.Name())
 		return
 	}
 
-	warnRange, err := nagiosplugin.ParseRange(warning)
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		check.AddResultf(nagiosplugin.WARNING, "%v is %v on %v, expected %v from the automation config", parameter, actual, host.Name(), expected)
+		return
+	}
+
+	check.AddResultf(nagiosplugin.OK, "%v is %v on %v, as in the automation config", parameter, actual, host.Name())
+}
+
+func doVoterCheck(check *util.Report, api *util.MMSAPI) {
+	config, err := api.GetAutomationConfig(groupId)
 	if err != nil {
-		check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing warning range. Error: %v", err)
+		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
 		return
 	}
 
-	if warnRange.Check(age.Seconds()) {
-		check.AddResultf(nagiosplugin.WARNING, fmt.Sprintf("Last ping was %v seconds ago", age.Seconds()))
+	replicaSetConfig := config.ReplicaSet(replicaSet)
+	if replicaSetConfig == nil {
+		check.AddResultf(nagiosplugin.UNKNOWN, "Replica set %v not found in the automation config", replicaSet)
 		return
 	}
 
-	check.AddResultf(nagiosplugin.OK, fmt.Sprintf("Last ping was %v seconds ago", age.Seconds()))
+	voters := replicaSetConfig.Voters()
+	check.AddPerfDatum("voters", "", float64(voters))
+
+	switch {
+	case voters < expectVoters:
+		check.AddResultf(nagiosplugin.CRITICAL, "%v voting members, expected %v", voters, expectVoters)
+	case voters > expectVoters:
+		check.AddResultf(nagiosplugin.WARNING, "%v voting members, expected %v", voters, expectVoters)
+	default:
+		check.AddResultf(nagiosplugin.OK, "%v voting members", voters)
+	}
 }
 
-func doMetricCheck(check *nagiosplugin.Check, api *util.MMSAPI, host *model.Host) {
-	var metric *model.Metric
-	var err error
-	if dbName == "" {
-		metric, err = api.GetHostMetric(groupId, host.Id, metricName, granularity, period)
-	} else {
-		metric, err = api.GetHostDBMetric(groupId, host.Id, metricName, dbName, granularity, period)
+// finish prints the report in the first --output format and exits with the
+// matching nagios status, after writing any further formats to --output-file.
+// Only the first call prints anything, so that a signal arriving while the
+// check finishes cannot mix two outputs.
+func finish(check *util.Report) {
+	finishMutex.Lock()
+
+	if compactPerfData {
+		check.CompactPerfData(perfDataPrecision)
+	}
+
+	formats := strings.Split(output, ",")
+	if len(formats) > 1 {
+		var body []byte
+		for _, format := range formats[1:] {
+			rendered, err := render(check, format)
+			if err != nil {
+				check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+				break
+			}
+			body = append(body, rendered...)
+		}
+
+		if err := ioutil.WriteFile(outputFile, body, 0644); err != nil {
+			check.AddResultf(nagiosplugin.UNKNOWN, "Failed to write output file. Error: %v", err)
+		}
 	}
 
+	body, err := render(check, formats[0])
 	if err != nil {
-		check.AddResultf(nagiosplugin.UNKNOWN, "%v", err)
+		fmt.Fprintf(os.Stdout, "UNKNOWN: %v\n", err)
+		os.Exit(int(nagiosplugin.UNKNOWN))
+	}
+
+	if formats[0] == "nagios" && useColor() {
+		body = colorize(body, check.ExitStatus())
+	}
+
+	fmt.Fprint(os.Stdout, string(body))
+
+	// CSV and OTLP output are for analysis rather than alerting, so they
+	// always exit 0.
+	if formats[0] == "csv" || formats[0] == "otlp" {
+		os.Exit(0)
+	}
+
+	os.Exit(int(check.ExitStatus()))
+}
+
+// render renders the report in a single output format.
+func render(check *util.Report, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		body, err := check.JSON()
+		if err != nil {
+			return nil, err
+		}
+		return append(body, '\n'), nil
+	case "csv":
+		return check.CSV()
+	case "influx-lp":
+		return check.InfluxLineProtocol("mongodb_mms"), nil
+	case "otlp":
+		return exportOTLP(check)
+	}
+
+	if strictNagios {
+		return []byte(check.StrictString(strictMaxLength) + "\n"), nil
+	}
+
+	// Multi-target checks follow the summary line with a block per target.
+	if longOutput := check.LongOutput(); longOutput != "" {
+		return []byte(check.Check().String() + "\n" + longOutput + "\n"), nil
+	}
+
+	return []byte(check.Check().String() + "\n"), nil
+}
+
+// statusColors are the ANSI colors of the status line when run interactively.
+var statusColors = map[nagiosplugin.Status]string{
+	nagiosplugin.OK:       "\x1b[32m",
+	nagiosplugin.WARNING:  "\x1b[33m",
+	nagiosplugin.CRITICAL: "\x1b[31m",
+	nagiosplugin.UNKNOWN:  "\x1b[35m",
+}
+
+// useColor reports whether nagios output should be colored. By default it is
+// only colored when stdout is a terminal, so nagios always sees plain text.
+func useColor() bool {
+	if noColor {
+		return false
+	}
+	if color {
+		return true
+	}
+
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize colors the status line of rendered nagios output. The long output
+// is left alone.
+func colorize(body []byte, status nagiosplugin.Status) []byte {
+	lines := strings.SplitN(string(body), "\n", 2)
+	lines[0] = statusColors[status] + lines[0] + "\x1b[0m"
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// exportOTLP pushes the metrics of the report to --otlp-endpoint, returning
+// a line saying so in place of rendered output.
+func exportOTLP(check *util.Report) ([]byte, error) {
+	body, err := check.OTLP(map[string]string{"mongodb.group_id": groupId, "mongodb.host": hostname})
+	if err == nil {
+		err = util.PushOTLP(otlpEndpoint, body, time.Duration(timeout)*time.Second)
+	}
+
+	if err != nil {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "OTLP export to %v failed: %v\n", otlpEndpoint, err)
+		}
+		return nil, err
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Exported %v perfdata values and %v series to %v\n", len(check.PerfData), len(check.Series), otlpEndpoint)
+	}
+
+	return []byte(fmt.Sprintf("Exported metrics to %v\n", otlpEndpoint)), nil
+}
+
+// hasOutput reports whether format is one of the --output formats.
+func hasOutput(format string) bool {
+	for _, name := range strings.Split(output, ",") {
+		if name == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addPerfDataAll adds every data point of the window as perfdata, multiplied
+// by scale, and as a series for the output formats that can show it.
+func addPerfDataAll(check *util.Report, opts *checkOptions, metric *model.Metric, unit string, scale float64) {
+	for i, dataPoint := range metric.DataPoints {
+		check.AddPerfDatum(fmt.Sprintf("%v_%v", opts.metricName, i), unit, dataPoint.Value*scale)
+	}
+
+	check.AddSeries(opts.metricName, metric.DataPoints)
+}
+
+// perfThresholds returns the lowest and highest value of the metric over the
+// period and its warning and critical thresholds, multiplied by scale, as the
+// min, max, warn and crit of its perfdata, so that graphs can draw threshold
+// lines. Only thresholds with a single bound can be drawn, so there are none
+// for stepped thresholds or ranges bounded on both sides.
+func perfThresholds(opts *checkOptions, metric *model.Metric, scale float64) []float64 {
+	if opts.steppedThresholds != "" {
+		return nil
+	}
+
+	warn, ok := rangeBound(opts.warning, metric.Units)
+	if ok == false {
+		return nil
+	}
+
+	crit, ok := rangeBound(opts.critical, metric.Units)
+	if ok == false {
+		return nil
+	}
+
+	minimum, err := util.Aggregate("min", metric.Values())
+	if err != nil {
+		return nil
+	}
+	maximum, _ := util.Aggregate("max", metric.Values())
+
+	return []float64{minimum * scale, maximum * scale, warn * scale, crit * scale}
+}
+
+// rangeBound returns the single bound of a threshold range that alerts
+// outside of it, such as 10 or 10:.
+func rangeBound(rangeStr string, units string) (float64, bool) {
+	parsed, err := parseRange(rangeStr, units, 1)
+	if err != nil || parsed.AlertOnInside {
+		return 0, false
+	}
+
+	lowerBounded := parsed.Start != 0 && !math.IsInf(parsed.Start, -1)
+	upperBounded := !math.IsInf(parsed.End, 1)
+	switch {
+	case upperBounded && !lowerBounded:
+		return parsed.End, true
+	case lowerBounded && !upperBounded:
+		return parsed.Start, true
+	}
+
+	return 0, false
+}
+
+// checkThresholds compares value against the critical and warning ranges and
+// adds a result with the first status that matches.
+func checkThresholds(check *util.Report, opts *checkOptions, value float64, units string, message string) {
+	checkScaledThresholds(check, opts, value, units, 1, message)
+}
+
+// checkScaledThresholds is checkThresholds with every threshold multiplied by
+// factor first.
+func checkScaledThresholds(check *util.Report, opts *checkOptions, value float64, units string, factor float64, message string) {
+	if thresholdSource != "" {
+		message = fmt.Sprintf("%v (critical threshold from %v)", message, thresholdSource)
+	}
+
+	record := &decision{Message: message, Value: value, Units: units, Factor: factor, Aggregation: opts.hostAggregation}
+	if explain {
+		defer explainDecision(check, opts, record)
+	}
+
+	if opts.steppedThresholds != "" {
+		record.Thresholds = opts.steppedThresholds
+		checkSteppedThresholds(check, opts, value, units, factor, message, record)
 		return
 	}
 
-	if len(metric.DataPoints) == 0 {
-		check.AddResultf(nagiosplugin.UNKNOWN, "No data points found for %v", metricName)
+	record.Critical, record.Warning = opts.critical, opts.warning
+	critRange, err := parseRange(opts.critical, units, factor)
+	if err != nil {
+		record.Matched = "error"
+		check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing critical range. Error: %v", err)
 		return
 	}
 
-	lastDataPoint := metric.DataPoints[len(metric.DataPoints)-1]
-	age := time.Since(lastDataPoint.Timestamp)
-	if int(age.Seconds()) > maxAge {
-		check.AddResultf(nagiosplugin.CRITICAL, "Last data point for %v is %v seconds old.", metricName, int(age.Seconds()))
+	if critRange.Check(value) {
+		record.Matched = "critical"
+		check.AddResult(nagiosplugin.CRITICAL, message)
+		return
+	}
+
+	warnRange, err := parseRange(opts.warning, units, factor)
+	if err != nil {
+		record.Matched = "error"
+		check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing warning range. Error: %v", err)
 		return
 	}
 
-	check.AddPerfDatum(metricName, "", lastDataPoint.Value)
+	if warnRange.Check(value) {
+		record.Matched = "warning"
+		check.AddResult(nagiosplugin.WARNING, message)
+		return
+	}
+
+	record.Matched = "none"
+	check.AddResult(nagiosplugin.OK, message)
+}
 
-	critRange, err := nagiosplugin.ParseRange(critical)
+// checkSteppedThresholds adds a result with the status of the highest
+// --thresholds step, multiplied by factor, that value exceeds.
+func checkSteppedThresholds(check *util.Report, opts *checkOptions, value float64, units string, factor float64, message string, record *decision) {
+	steps, err := util.ParseSteppedThresholds(opts.steppedThresholds, units)
 	if err != nil {
-		check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing critical range. Error: %v", err)
+		record.Matched = "error"
+		check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing thresholds. Error: %v", err)
 		return
 	}
 
-	if critRange.Check(lastDataPoint.Value) {
-		check.AddResultf(nagiosplugin.CRITICAL, metric.ToStringLastDataPoint())
+	for i := range steps {
+		steps[i].Value *= factor
+	}
+
+	step := util.BreachedStep(steps, value)
+	if step == nil {
+		record.Matched = "none"
+		check.AddResult(nagiosplugin.OK, message)
 		return
 	}
 
-	warnRange, err := nagiosplugin.ParseRange(warning)
+	record.Matched = step.Name
+	check.AddResultf(step.Status, "%v (above %v threshold of %v)", message, strings.ToUpper(step.Name), step.Value)
+}
+
+// decision is the --explain record of how a threshold check reached its
+// status. Matched is the range or step the value fell in: critical, warning,
+// the name of a --thresholds step, none, or error if the thresholds did not
+// parse.
+type decision struct {
+	Time        string  `json:"time"`
+	Host        string  `json:"host,omitempty"`
+	Metric      string  `json:"metric,omitempty"`
+	Message     string  `json:"message"`
+	Value       float64 `json:"value"`
+	Units       string  `json:"units,omitempty"`
+	Factor      float64 `json:"factor"`
+	Aggregation string  `json:"aggregation"`
+	Warning     string  `json:"warning,omitempty"`
+	Critical    string  `json:"critical,omitempty"`
+	Thresholds  string  `json:"thresholds,omitempty"`
+	Matched     string  `json:"matched"`
+	Status      string  `json:"status"`
+}
+
+var traceMutex sync.Mutex
+
+// explainDecision writes record as a line of JSON to --trace-file, or to
+// stderr without one, taking its status from the result just added.
+func explainDecision(check *util.Report, opts *checkOptions, record *decision) {
+	record.Time = time.Now().UTC().Format(time.RFC3339)
+	record.Host = hostname
+	record.Metric = opts.metricName
+	if len(check.Results) > 0 {
+		record.Status = check.Results[len(check.Results)-1].Status.String()
+	}
+
+	body, err := json.Marshal(record)
 	if err != nil {
-		check.AddResultf(nagiosplugin.UNKNOWN, "Error parsing warning range. Error: %v", err)
 		return
 	}
 
-	if warnRange.Check(lastDataPoint.Value) {
-		check.AddResultf(nagiosplugin.WARNING, metric.ToStringLastDataPoint())
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+
+	if traceFile == "" {
+		fmt.Fprintln(os.Stderr, string(body))
+		return
+	}
+
+	file, err := os.OpenFile(traceFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open trace file. Error: %v\n", err)
 		return
 	}
+	defer file.Close()
 
-	check.AddResultf(nagiosplugin.OK, metric.ToStringLastDataPoint())
+	fmt.Fprintln(file, string(body))
+}
+
+// parseRange parses a nagios threshold range after converting any human
+// friendly values (8G, 90%) into the given metric units and multiplying its
+// bounds by factor.
+func parseRange(rangeStr string, units string, factor float64) (*nagiosplugin.Range, error) {
+	converted, err := util.ScaleRange(rangeStr, units, factor)
+	if err != nil {
+		return nil, err
+	}
+
+	return nagiosplugin.ParseRange(converted)
 }
 
 func setupFlags() {
@@ -150,7 +2975,7 @@ func setupFlags() {
 		hostnameDefault = ""
 		hostnameUsage   = "hostname:port of the mongod/s to check"
 		metricDefault   = ""
-		metricUsage     = "metric to query"
+		metricUsage     = "metric to query, or a comma separated list of metrics to check at once"
 		dbNameDefault   = ""
 		dbNameUsage     = "database name for DB_ metrics"
 		serverDefault   = "https://mms.mongodb.com"
@@ -160,7 +2985,7 @@ func setupFlags() {
 		criticalDefault = "~:"
 		criticalUsage   = "critical threshold for given metric"
 		timeoutDefault  = 10
-		timeoutUsage    = "connection timeout connecting MMS/Ops Manager service"
+		timeoutUsage    = "timeout in seconds for all requests to the MMS/Ops Manager service, including retries"
 		maxAgeDefault   = 360
 		maxAgeUsage     = "the maximum number of seconds old a metric before it is considerd stale"
 		granularityDefault	= "MINUTE"
@@ -171,6 +2996,201 @@ func setupFlags() {
 		usernameUsage	= "the username for auth"
 		apiKeyDefault	= ""
 		apiKeyUsage	    = "the api key for the user"
+		agentErrorsDefault = false
+		agentErrorsUsage   = "check the agent log for recent errors instead of a metric"
+		agentTypeDefault   = "MONITORING"
+		agentTypeUsage     = "the agent whose log is checked. Acceptable values are MONITORING BACKUP AUTOMATION"
+		patternDefault     = ""
+		patternUsage       = "only count agent log errors whose message matches this regular expression"
+		strictNagiosDefault    = false
+		strictNagiosUsage      = "print a single 'STATUS - message | perfdata' line for strict NRPE consumers"
+		strictMaxLengthDefault = 200
+		strictMaxLengthUsage   = "the maximum length of the message in strict nagios output"
+		detectCountersDefault  = false
+		detectCountersUsage    = "report counters, the metrics counted since the process started such as ASSERT_REGULAR, with the 'c' perfdata unit. The classification is cached in --cache-file per Ops Manager version"
+		cacheFileDefault       = "$HOME/" + CacheFile
+		cacheFileUsage         = "the file used to cache lookups between runs. An empty value disables caching"
+		replicaSetDefault      = ""
+		replicaSetUsage        = "check that the named replica set has a primary instead of checking a single host, and with -m the metric on each member"
+		expectVotersDefault    = 0
+		expectVotersUsage      = "in replica set mode, the expected number of voting members. 0 disables the check"
+		expandShardsDefault    = false
+		expandShardsUsage      = "when the host is a mongos, run the check against every shard member behind it instead"
+		unitOverrideUsage      = "force the perfdata unit for a metric, as METRIC=UOM. May be repeated"
+		autoGranularityDefault = false
+		autoGranularityUsage   = "pick the granularity from the period: MINUTE up to 48H, HOUR up to 63 days, DAY beyond"
+		indexBuildsDefault     = false
+		indexBuildsUsage       = "check the number of index builds in progress (" + IndexBuildsMetric + ")"
+		thresholdsDefault      = ""
+		thresholdsUsage        = "stepped thresholds such as warn:70,crit:85,emergency:95, used instead of -w and -c"
+		includeHiddenDefault   = false
+		includeHiddenUsage     = "treat hidden replica set members like any other member instead of ignoring their staleness"
+		probeLatencyDefault    = false
+		probeLatencyUsage      = "only check that the API responds for the group, reporting the response time"
+		outputDefault          = "nagios"
+		outputUsage            = "the output format. Acceptable values are nagios json csv influx-lp otlp, or a comma separated list whose first format is printed and the rest written to --output-file"
+		perfDataAllDefault     = false
+		perfDataAllUsage       = "report every data point in the period, not just the last, in perfdata and JSON output"
+		nullPolicyDefault      = "skip"
+		nullPolicyUsage        = "what to do when the last data point has no value: skip back to the last value, return unknown, or treat it as zero"
+		maxRuntimeDefault      = 0
+		maxRuntimeUsage        = "the maximum number of seconds the whole check may run before reporting what completed. 0 disables the limit"
+		hostAggregationDefault = "worst"
+		hostAggregationUsage   = "how multi-host checks combine hosts: worst status of each host, or the sum, max or avg of their values"
+		labelWithHostDefault   = false
+		labelWithHostUsage     = "prefix perfdata labels with the short hostname, e.g. shard01_CONNECTIONS"
+		metricMapDefault       = ""
+		metricMapUsage         = "a JSON file of named check bundles, each a list of metrics with their thresholds"
+		bundleDefault          = ""
+		bundleUsage            = "run every metric check of the named bundle from --metric-map"
+		validateDefault        = false
+		validateUsage          = "check that the host, metric, database and thresholds are valid without evaluating any values"
+		waitForDefault         = 0
+		waitForUsage           = "keep polling for up to this many seconds until the check is OK, e.g. to verify a deploy. 0 checks once"
+		pollIntervalDefault    = 10
+		pollIntervalUsage      = "the number of seconds between polls with --wait-for"
+		growthDefault          = ""
+		growthUsage            = "threshold the absolute or percent growth of the metric since one period ago instead of its value"
+		capacityDefault        = ""
+		capacityUsage          = "with --growth, the capacity of the metric (e.g. 500G), used to project when it will be full"
+		configServersDefault   = false
+		configServersUsage     = "when the host is a mongos, check that every config server of its cluster has pinged within --maxage"
+		excludeUsage           = "leave hosts whose hostname:port matches this regular expression out of multi-host checks. May be repeated"
+		deploymentDefault      = false
+		deploymentUsage        = "check the rolled-up deployment health of the group, with a breakdown per subsystem"
+		electionsDefault       = false
+		electionsUsage         = "threshold the number of replica set elections in the period (" + ElectionsMetric + ")"
+		assertionTypeDefault   = ""
+		assertionTypeUsage     = "threshold the number of assertions raised in the period. Acceptable values are regular warning msg user all"
+		dumpRawDefault         = false
+		dumpRawUsage           = "print the raw JSON response for the metric to stderr and exit OK without evaluating it"
+		serverFallbackDefault  = ""
+		serverFallbackUsage    = "a second MMS/Ops Manager server to try when --server cannot be reached"
+		verboseDefault         = false
+		verboseUsage           = "print diagnostic details, such as which server answered, to stderr"
+		wiredTigerDefault      = ""
+		wiredTigerUsage        = "check the WiredTiger cache. Acceptable values are dirty used (percent of --cache-size) eviction (bytes per second)"
+		cacheSizeDefault       = ""
+		cacheSizeUsage         = "with --wiredtiger dirty or used, the configured WiredTiger cache size, e.g. 8G"
+		rateSinceLastRunDefault = false
+		rateSinceLastRunUsage   = "threshold the per second rate of a counter since the value seen by the previous run, kept in --cache-file"
+		expectShardsDefault    = 0
+		expectShardsUsage      = "when the host is a mongos, the expected number of shards in its cluster. 0 disables the check"
+		chunkSkewDefault       = 0.0
+		chunkSkewUsage         = "when the host is a mongos, warn when the difference between the most and least loaded shard exceeds this percent of the average chunk count. 0 disables the check"
+		onNoHostDefault        = "unknown"
+		onNoHostUsage          = "the status when the host is not known to MMS/Ops Manager. Acceptable values are ok warn crit unknown"
+		envelopeDefault        = false
+		envelopeUsage          = "report the min, max and current value of the metric over the period, thresholding the current value as a percent of the max"
+		outputFileDefault      = ""
+		outputFileUsage        = "the file the second and later --output formats are written to"
+		automationDriftDefault = false
+		automationDriftUsage   = "threshold how many versions the furthest behind process lags the goal automation config version. Warns on any lag by default"
+		thresholdPerHostDefault = false
+		thresholdPerHostUsage   = "with --host-aggregation, multiply the thresholds by the number of hosts checked"
+		fromAlertConfigDefault = false
+		fromAlertConfigUsage   = "use the threshold of the enabled Ops Manager alert config for the metric as the critical threshold"
+		globalLockDefault      = false
+		globalLockUsage        = "threshold the percent of time the global lock was held (" + GlobalLockMetric + ")"
+		compactPerfDataDefault = false
+		compactPerfDataUsage   = "round perfdata to --perfdata-precision decimal places and leave out min and max, to shorten the output"
+		perfDataPrecisionDefault = 2
+		perfDataPrecisionUsage   = "the number of decimal places perfdata is rounded to with --compact-perfdata"
+		activeWindowDefault    = ""
+		activeWindowUsage      = "only evaluate the check within this weekly window, e.g. 'Mon-Fri 09:00-18:00 Europe/Berlin', and report OK outside it"
+		probeAllMetricsDefault = false
+		probeAllMetricsUsage   = "fetch the latest value of every metric the host reports, as a snapshot, e.g. during an incident"
+		concurrencyDefault     = 4
+		concurrencyUsage       = "the maximum number of metrics fetched at once with --probe-all-metrics"
+		cursorsDefault         = false
+		cursorsUsage           = "threshold the number of open cursors (" + CursorsOpenMetric + "), also reporting those timed out in the period"
+		warnOnDeprecationDefault = false
+		warnOnDeprecationUsage   = "warn when MMS/Ops Manager reports that an API the check uses is deprecated"
+		certExpiryDefault      = false
+		certExpiryUsage        = "check the number of days until the TLS certificate of the MMS/Ops Manager server expires"
+		warnDaysDefault        = 30
+		warnDaysUsage          = "with --cert-expiry, warn when the certificate expires within this many days"
+		critDaysDefault        = 7
+		critDaysUsage          = "with --cert-expiry, go critical when the certificate expires within this many days"
+		minHealthyPercentDefault      = 0.0
+		minHealthyPercentUsage        = "in multi-host checks, only warn when fewer than this percent of hosts are OK, instead of on any host. 0 disables it"
+		criticalHealthyPercentDefault = 0.0
+		criticalHealthyPercentUsage   = "with --min-healthy-percent, go critical when fewer than this percent of hosts are OK"
+		colorDefault           = false
+		colorUsage             = "always color the status in nagios output, even when stdout is not a terminal"
+		noColorDefault         = false
+		noColorUsage           = "never color the status in nagios output, even when stdout is a terminal"
+		oplogChurnDefault      = false
+		oplogChurnUsage        = "check the rate at which the oplog is written, in GB per hour"
+		oplogSizeDefault       = ""
+		oplogSizeUsage         = "with --oplog-churn, the size of the oplog (e.g. 50G, or a number of GB), used to project the oplog window"
+		noDedupeDefault        = false
+		noDedupeUsage          = "keep data points with duplicate timestamps instead of keeping only the last of them"
+		testAuthDefault        = false
+		testAuthUsage          = "only check that the configured credentials are accepted, without a group ID or host"
+		perTargetTimeoutDefault = 0
+		perTargetTimeoutUsage   = "in multi-host checks, the number of seconds each host may take before it alone is reported as UNKNOWN. 0 disables it"
+		scanRatioDefault       = false
+		scanRatioUsage         = "check the number of documents scanned by queries for each document returned"
+		rateLimitDefault       = ""
+		rateLimitUsage         = "the maximum number of API requests per second across all hosts and metrics, between 0.01 and 1000, e.g. 10/sec"
+		zScoreDefault          = false
+		zScoreUsage            = "threshold the number of standard deviations the last value is from the mean of the period, rather than the value. Defaults to -w -3:3 -c -4:4"
+		stalenessSourceDefault = "datapoint"
+		stalenessSourceUsage   = "the timestamp checked against --maxage in metric checks: datapoint, the last data point, or lastping, the last ping of the host"
+		topologyTTLDefault     = 0
+		topologyTTLUsage       = "with --expand-shards or --config-servers, reuse the hosts of the cluster for this many seconds across runs, kept in --cache-file. Their state, such as the last ping, is still fetched when the check needs it. 0 disables it"
+		parameterDefault       = ""
+		parameterUsage         = "check that the host runs with the value of this startup option from the automation config, e.g. storage.wiredTiger.engineConfig.cacheSizeGB"
+		warnOnRedirectHostMismatchDefault = false
+		warnOnRedirectHostMismatchUsage   = "warn when the MMS/Ops Manager server redirects to a different host than the one requested"
+		strictHostDefault      = false
+		strictHostUsage        = "refuse to follow redirects to a different host than the one requested"
+		databaseCountDefault   = false
+		databaseCountUsage     = "check the number of databases on the host, naming the largest"
+		explainDefault         = false
+		explainUsage           = "write a line of JSON for each threshold decision, with the value, thresholds and the range it matched, to stderr or --trace-file"
+		traceFileDefault       = ""
+		traceFileUsage         = "with --explain, the file the decisions are appended to instead of stderr"
+		gracePeriodDefault     = ""
+		gracePeriodUsage       = "downgrade CRITICAL to WARNING for hosts added to MMS/Ops Manager less than this long ago, e.g. 2H"
+		otlpEndpointDefault    = "http://localhost:4318/v1/metrics"
+		otlpEndpointUsage      = "with --output otlp, the OTLP/HTTP metrics endpoint the metrics are pushed to"
+		valueFieldDefault      = ""
+		valueFieldUsage        = "for metrics whose data points hold several sub-values, the name of the sub-value to check"
+		summarizeDefault       = false
+		summarizeUsage         = "report the min, avg, max and last value over the period, as perfdata and in the message"
+		summarizeThresholdDefault = "last"
+		summarizeThresholdUsage   = "with --summarize, the value the thresholds apply to. Acceptable values are last min avg max"
+		functionDefault        = "last"
+		functionUsage          = "the value of the period compared with the thresholds in metric checks. Acceptable values are last avg min max p95"
+		retriesDefault         = 2
+		retriesUsage           = "number of times a request that failed to connect or got a 5xx response is retried, backing off exponentially within the timeout"
+		listMetricsDefault     = false
+		listMetricsUsage       = "list the name and units of every metric the host reports in the long output, for finding the name to pass to --metric, without checking any"
+		proxyDefault           = ""
+		proxyUsage             = "URL of the proxy to connect through, e.g. http://proxy.example.com:3128, instead of the one from HTTP_PROXY and HTTPS_PROXY"
+		staleStatusDefault     = "critical"
+		staleStatusUsage       = "the status when the last data point is older than --maxage, e.g. unknown as stale data usually means a problem with the agent. Acceptable values are ok warning critical unknown"
+		clusterDefault         = ""
+		clusterUsage           = "check the last ping, or with -m the metric, of every member of the named replica set or sharded cluster instead of a single host"
+		realmDefault           = ""
+		realmUsage             = "the digest authentication realm, for Ops Manager installs whose challenge names a different realm than the credentials are valid for"
+		expectTypeDefault      = ""
+		expectTypeUsage        = "without -m, also check that the host is of this type, e.g. REPLICA_PRIMARY, REPLICA_SECONDARY or STANDALONE, and critical otherwise"
+		rateOfChangeDefault    = false
+		rateOfChangeUsage      = "compare the per second rate of change between the last two data points with the thresholds, for counters. A counter reset counts as no change. The perfdata is the rate without a unit, in bytes or seconds per second for metrics measured in sizes or durations"
+		hostIdDefault          = ""
+		hostIdUsage            = "the ID of the host to check instead of --hostname, which saves looking it up by name in metric checks"
+		checkAlertsDefault     = false
+		checkAlertsUsage       = "critical if Ops Manager has any open alert for the host, listing their event types"
+		caFileDefault          = ""
+		caFileUsage            = "PEM bundle of the certificate authorities to trust instead of the system ones, for internally signed certificates"
+		insecureDefault        = false
+		insecureUsage          = "do not verify the certificate of the MMS/Ops Manager service"
+		exactCountersDefault   = false
+		exactCountersUsage     = "compute the change of integer counters from their exact values, for counters beyond 2^53 that a float64 cannot hold exactly"
+		headerUsage            = "an HTTP header sent with every API request, as 'Name: value'. May be repeated, and overrides Accept: application/json"
 
 	)
 
@@ -213,8 +3233,209 @@ func setupFlags() {
 	flag.StringVar(&apiKey, "apikey", apiKeyDefault, usernameUsage)
 	flag.StringVar(&apiKey, "k", apiKeyDefault, apiKeyUsage)
 
+	flag.BoolVar(&agentErrors, "agent-errors", agentErrorsDefault, agentErrorsUsage)
+
+	flag.StringVar(&agentType, "agent-type", agentTypeDefault, agentTypeUsage)
+
+	flag.StringVar(&agentPattern, "pattern", patternDefault, patternUsage)
+
+	flag.BoolVar(&strictNagios, "strict-nagios", strictNagiosDefault, strictNagiosUsage)
+
+	flag.IntVar(&strictMaxLength, "strict-max-length", strictMaxLengthDefault, strictMaxLengthUsage)
+
+	flag.BoolVar(&detectCounters, "detect-counters", detectCountersDefault, detectCountersUsage)
+
+	flag.StringVar(&cacheFile, "cache-file", filepath.Join(os.Getenv("HOME"), CacheFile), cacheFileUsage)
+
+	flag.StringVar(&replicaSet, "replica-set", replicaSetDefault, replicaSetUsage)
+
+	flag.IntVar(&expectVoters, "expect-voters", expectVotersDefault, expectVotersUsage)
+
+	flag.BoolVar(&expandShards, "expand-shards", expandShardsDefault, expandShardsUsage)
+
+	flag.Var(unitOverrides, "unit-override", unitOverrideUsage)
+
+	flag.BoolVar(&autoGranularity, "auto-granularity", autoGranularityDefault, autoGranularityUsage)
+
+	flag.BoolVar(&indexBuilds, "index-builds", indexBuildsDefault, indexBuildsUsage)
+
+	flag.StringVar(&steppedThresholds, "thresholds", thresholdsDefault, thresholdsUsage)
+
+	flag.BoolVar(&includeHidden, "include-hidden", includeHiddenDefault, includeHiddenUsage)
+
+	flag.BoolVar(&probeLatency, "probe-latency-only", probeLatencyDefault, probeLatencyUsage)
+
+	flag.StringVar(&output, "output", outputDefault, outputUsage)
+
+	flag.BoolVar(&perfDataAll, "perfdata-all", perfDataAllDefault, perfDataAllUsage)
+
+	flag.StringVar(&nullPolicy, "null-policy", nullPolicyDefault, nullPolicyUsage)
+
+	flag.IntVar(&maxRuntime, "max-runtime", maxRuntimeDefault, maxRuntimeUsage)
+
+	flag.StringVar(&hostAggregation, "host-aggregation", hostAggregationDefault, hostAggregationUsage)
+
+	flag.BoolVar(&labelWithHost, "label-with-host", labelWithHostDefault, labelWithHostUsage)
+
+	flag.StringVar(&metricMapFile, "metric-map", metricMapDefault, metricMapUsage)
+
+	flag.StringVar(&bundle, "bundle", bundleDefault, bundleUsage)
+
+	flag.BoolVar(&validate, "validate", validateDefault, validateUsage)
+
+	flag.IntVar(&waitFor, "wait-for", waitForDefault, waitForUsage)
+
+	flag.IntVar(&pollInterval, "poll-interval", pollIntervalDefault, pollIntervalUsage)
+
+	flag.StringVar(&growth, "growth", growthDefault, growthUsage)
+
+	flag.StringVar(&capacity, "capacity", capacityDefault, capacityUsage)
+
+	flag.BoolVar(&configServers, "config-servers", configServersDefault, configServersUsage)
+
+	flag.Var(&excludes, "exclude", excludeUsage)
+
+	flag.BoolVar(&deployment, "deployment", deploymentDefault, deploymentUsage)
+
+	flag.Var(headers, "header", headerUsage)
+
+	flag.BoolVar(&elections, "elections", electionsDefault, electionsUsage)
+
+	flag.StringVar(&assertionType, "assertion-type", assertionTypeDefault, assertionTypeUsage)
+
+	flag.BoolVar(&dumpRaw, "dump-raw", dumpRawDefault, dumpRawUsage)
+
+	flag.StringVar(&serverFallback, "server-fallback", serverFallbackDefault, serverFallbackUsage)
+
+	flag.BoolVar(&verbose, "verbose", verboseDefault, verboseUsage)
+	flag.BoolVar(&verbose, "v", verboseDefault, verboseUsage)
+
+	flag.StringVar(&wiredTiger, "wiredtiger", wiredTigerDefault, wiredTigerUsage)
+
+	flag.StringVar(&cacheSize, "cache-size", cacheSizeDefault, cacheSizeUsage)
+
+	flag.BoolVar(&rateSinceLastRun, "rate-since-last-run", rateSinceLastRunDefault, rateSinceLastRunUsage)
+
+	flag.IntVar(&expectShards, "expect-shards", expectShardsDefault, expectShardsUsage)
+
+	flag.Float64Var(&chunkSkew, "chunk-skew", chunkSkewDefault, chunkSkewUsage)
+
+	flag.StringVar(&onNoHost, "on-no-host", onNoHostDefault, onNoHostUsage)
+
+	flag.BoolVar(&envelope, "envelope", envelopeDefault, envelopeUsage)
+
+	flag.StringVar(&outputFile, "output-file", outputFileDefault, outputFileUsage)
+
+	flag.BoolVar(&automationDrift, "automation-drift", automationDriftDefault, automationDriftUsage)
+
+	flag.BoolVar(&thresholdPerHost, "threshold-per-host", thresholdPerHostDefault, thresholdPerHostUsage)
+
+	flag.BoolVar(&fromAlertConfig, "from-alert-config", fromAlertConfigDefault, fromAlertConfigUsage)
+
+	flag.BoolVar(&globalLock, "global-lock", globalLockDefault, globalLockUsage)
+
+	flag.BoolVar(&compactPerfData, "compact-perfdata", compactPerfDataDefault, compactPerfDataUsage)
+
+	flag.IntVar(&perfDataPrecision, "perfdata-precision", perfDataPrecisionDefault, perfDataPrecisionUsage)
+
+	flag.StringVar(&activeWindow, "active-window", activeWindowDefault, activeWindowUsage)
+
+	flag.BoolVar(&probeAllMetrics, "probe-all-metrics", probeAllMetricsDefault, probeAllMetricsUsage)
+
+	flag.IntVar(&concurrency, "concurrency", concurrencyDefault, concurrencyUsage)
+
+	flag.BoolVar(&cursors, "cursors", cursorsDefault, cursorsUsage)
+
+	flag.BoolVar(&warnOnDeprecation, "warn-on-deprecation", warnOnDeprecationDefault, warnOnDeprecationUsage)
+
+	flag.BoolVar(&certExpiry, "cert-expiry", certExpiryDefault, certExpiryUsage)
+
+	flag.IntVar(&warnDays, "warn-days", warnDaysDefault, warnDaysUsage)
+
+	flag.IntVar(&critDays, "crit-days", critDaysDefault, critDaysUsage)
+
+	flag.Float64Var(&minHealthyPercent, "min-healthy-percent", minHealthyPercentDefault, minHealthyPercentUsage)
+
+	flag.Float64Var(&criticalHealthyPercent, "critical-healthy-percent", criticalHealthyPercentDefault, criticalHealthyPercentUsage)
+
+	flag.BoolVar(&color, "color", colorDefault, colorUsage)
+
+	flag.BoolVar(&noColor, "no-color", noColorDefault, noColorUsage)
+
+	flag.BoolVar(&oplogChurn, "oplog-churn", oplogChurnDefault, oplogChurnUsage)
+
+	flag.StringVar(&oplogSize, "oplog-size", oplogSizeDefault, oplogSizeUsage)
+
+	flag.BoolVar(&noDedupe, "no-dedupe", noDedupeDefault, noDedupeUsage)
+
+	flag.BoolVar(&testAuth, "test-auth", testAuthDefault, testAuthUsage)
+
+	flag.IntVar(&perTargetTimeout, "per-target-timeout", perTargetTimeoutDefault, perTargetTimeoutUsage)
+
+	flag.BoolVar(&scanRatio, "scan-ratio", scanRatioDefault, scanRatioUsage)
+
+	flag.StringVar(&rateLimit, "rate-limit", rateLimitDefault, rateLimitUsage)
+
+	flag.BoolVar(&zScore, "zscore", zScoreDefault, zScoreUsage)
+
+	flag.StringVar(&stalenessSource, "staleness-source", stalenessSourceDefault, stalenessSourceUsage)
+
+	flag.IntVar(&topologyTTL, "topology-ttl", topologyTTLDefault, topologyTTLUsage)
+
+	flag.StringVar(&parameter, "parameter", parameterDefault, parameterUsage)
+
+	flag.BoolVar(&warnOnRedirectHostMismatch, "warn-on-redirect-host-mismatch", warnOnRedirectHostMismatchDefault, warnOnRedirectHostMismatchUsage)
+
+	flag.BoolVar(&strictHost, "strict-host", strictHostDefault, strictHostUsage)
+
+	flag.BoolVar(&databaseCount, "database-count", databaseCountDefault, databaseCountUsage)
+
+	flag.BoolVar(&explain, "explain", explainDefault, explainUsage)
+
+	flag.StringVar(&traceFile, "trace-file", traceFileDefault, traceFileUsage)
+
+	flag.StringVar(&gracePeriod, "grace-period", gracePeriodDefault, gracePeriodUsage)
+
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", otlpEndpointDefault, otlpEndpointUsage)
+
+	flag.StringVar(&valueField, "value-field", valueFieldDefault, valueFieldUsage)
+
+	flag.BoolVar(&summarize, "summarize", summarizeDefault, summarizeUsage)
+
+	flag.StringVar(&summarizeThreshold, "summarize-threshold", summarizeThresholdDefault, summarizeThresholdUsage)
+
+	flag.StringVar(&function, "function", functionDefault, functionUsage)
+	flag.StringVar(&function, "f", functionDefault, functionUsage)
+
+	flag.IntVar(&retries, "retries", retriesDefault, retriesUsage)
+
+	flag.BoolVar(&listMetrics, "list-metrics", listMetricsDefault, listMetricsUsage)
+
+	flag.StringVar(&proxy, "proxy", proxyDefault, proxyUsage)
+	flag.StringVar(&proxy, "x", proxyDefault, proxyUsage)
+
+	flag.StringVar(&staleStatus, "stale-status", staleStatusDefault, staleStatusUsage)
+
+	flag.StringVar(&cluster, "cluster", clusterDefault, clusterUsage)
+
+	flag.StringVar(&realm, "realm", realmDefault, realmUsage)
+
+	flag.StringVar(&expectType, "expect-type", expectTypeDefault, expectTypeUsage)
+
+	flag.BoolVar(&rateOfChange, "rate", rateOfChangeDefault, rateOfChangeUsage)
+
+	flag.StringVar(&hostId, "hostid", hostIdDefault, hostIdUsage)
+
+	flag.BoolVar(&checkAlerts, "check-alerts", checkAlertsDefault, checkAlertsUsage)
+
+	flag.StringVar(&caFile, "cafile", caFileDefault, caFileUsage)
+
+	flag.BoolVar(&insecure, "insecure", insecureDefault, insecureUsage)
+
+	flag.BoolVar(&exactCounters, "exact-counters", exactCountersDefault, exactCountersUsage)
+
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stdout, "Usage: check_mongodb_mms  -g groupid -H hostname [-m metric] [-d dbname] [-a age] [-s server] [-t timeout] [-w warning_level] [-c critica_level] [-r granularity] [-p period] [-u username] [-k apikey]\n")
+		fmt.Fprintf(os.Stdout, "Usage: check_mongodb_mms  -g groupid -H hostname [-m metric] [-d dbname] [-a age] [-s server] [-t timeout] [-w warning_level] [-c critica_level] [-r granularity] [-p period] [-u username] [-k apikey] [--agent-errors [--agent-type type] [--pattern regexp]]\n")
 		fmt.Fprintf(os.Stdout, "     -g, --groupid  %v\n", groupIdUsage)
 		fmt.Fprintf(os.Stdout, "     -H, --hostname %v\n", hostnameUsage)
 		fmt.Fprintf(os.Stdout, "     -m, --metric (no metric means check last ping age in seconds) %v\n", metricUsage)
@@ -228,8 +3449,109 @@ func setupFlags() {
 		fmt.Fprintf(os.Stdout, "     -p, --period (default: %v) %v\n", periodDefault, periodUsage)
 		fmt.Fprintf(os.Stdout, "     -u, --username (default: %v) %v\n", usernameDefault, usernameUsage)
 		fmt.Fprintf(os.Stdout, "     -k, --apiKey (default: %v) %v\n", apiKeyDefault, apiKeyUsage)
+		fmt.Fprintf(os.Stdout, "     --agent-errors %v\n", agentErrorsUsage)
+		fmt.Fprintf(os.Stdout, "     --agent-type (default: %v) %v\n", agentTypeDefault, agentTypeUsage)
+		fmt.Fprintf(os.Stdout, "     --pattern (default: %v) %v\n", patternDefault, patternUsage)
+		fmt.Fprintf(os.Stdout, "     --strict-nagios %v\n", strictNagiosUsage)
+		fmt.Fprintf(os.Stdout, "     --strict-max-length (default: %v) %v\n", strictMaxLengthDefault, strictMaxLengthUsage)
+		fmt.Fprintf(os.Stdout, "     --detect-counters %v\n", detectCountersUsage)
+		fmt.Fprintf(os.Stdout, "     --cache-file (default: %v) %v\n", cacheFileDefault, cacheFileUsage)
+		fmt.Fprintf(os.Stdout, "     --replica-set %v\n", replicaSetUsage)
+		fmt.Fprintf(os.Stdout, "     --expect-voters (default: %v) %v\n", expectVotersDefault, expectVotersUsage)
+		fmt.Fprintf(os.Stdout, "     --expand-shards %v\n", expandShardsUsage)
+		fmt.Fprintf(os.Stdout, "     --unit-override %v\n", unitOverrideUsage)
+		fmt.Fprintf(os.Stdout, "     --auto-granularity %v\n", autoGranularityUsage)
+		fmt.Fprintf(os.Stdout, "     --index-builds %v\n", indexBuildsUsage)
+		fmt.Fprintf(os.Stdout, "     --thresholds %v\n", thresholdsUsage)
+		fmt.Fprintf(os.Stdout, "     --include-hidden %v\n", includeHiddenUsage)
+		fmt.Fprintf(os.Stdout, "     --probe-latency-only %v\n", probeLatencyUsage)
+		fmt.Fprintf(os.Stdout, "     --output (default: %v) %v\n", outputDefault, outputUsage)
+		fmt.Fprintf(os.Stdout, "     --perfdata-all %v\n", perfDataAllUsage)
+		fmt.Fprintf(os.Stdout, "     --null-policy (default: %v) %v\n", nullPolicyDefault, nullPolicyUsage)
+		fmt.Fprintf(os.Stdout, "     --max-runtime (default: %v) %v\n", maxRuntimeDefault, maxRuntimeUsage)
+		fmt.Fprintf(os.Stdout, "     --host-aggregation (default: %v) %v\n", hostAggregationDefault, hostAggregationUsage)
+		fmt.Fprintf(os.Stdout, "     --label-with-host %v\n", labelWithHostUsage)
+		fmt.Fprintf(os.Stdout, "     --metric-map %v\n", metricMapUsage)
+		fmt.Fprintf(os.Stdout, "     --bundle %v\n", bundleUsage)
+		fmt.Fprintf(os.Stdout, "     --validate %v\n", validateUsage)
+		fmt.Fprintf(os.Stdout, "     --wait-for (default: %v) %v\n", waitForDefault, waitForUsage)
+		fmt.Fprintf(os.Stdout, "     --poll-interval (default: %v) %v\n", pollIntervalDefault, pollIntervalUsage)
+		fmt.Fprintf(os.Stdout, "     --growth %v\n", growthUsage)
+		fmt.Fprintf(os.Stdout, "     --capacity %v\n", capacityUsage)
+		fmt.Fprintf(os.Stdout, "     --config-servers %v\n", configServersUsage)
+		fmt.Fprintf(os.Stdout, "     --exclude %v\n", excludeUsage)
+		fmt.Fprintf(os.Stdout, "     --deployment %v\n", deploymentUsage)
+		fmt.Fprintf(os.Stdout, "     --header %v\n", headerUsage)
+		fmt.Fprintf(os.Stdout, "     --elections %v\n", electionsUsage)
+		fmt.Fprintf(os.Stdout, "     --assertion-type %v\n", assertionTypeUsage)
+		fmt.Fprintf(os.Stdout, "     --dump-raw %v\n", dumpRawUsage)
+		fmt.Fprintf(os.Stdout, "     --server-fallback %v\n", serverFallbackUsage)
+		fmt.Fprintf(os.Stdout, "     -v, --verbose %v\n", verboseUsage)
+		fmt.Fprintf(os.Stdout, "     --wiredtiger %v\n", wiredTigerUsage)
+		fmt.Fprintf(os.Stdout, "     --cache-size %v\n", cacheSizeUsage)
+		fmt.Fprintf(os.Stdout, "     --rate-since-last-run %v\n", rateSinceLastRunUsage)
+		fmt.Fprintf(os.Stdout, "     --expect-shards (default: %v) %v\n", expectShardsDefault, expectShardsUsage)
+		fmt.Fprintf(os.Stdout, "     --chunk-skew (default: %v) %v\n", chunkSkewDefault, chunkSkewUsage)
+		fmt.Fprintf(os.Stdout, "     --on-no-host (default: %v) %v\n", onNoHostDefault, onNoHostUsage)
+		fmt.Fprintf(os.Stdout, "     --envelope %v\n", envelopeUsage)
+		fmt.Fprintf(os.Stdout, "     --output-file %v\n", outputFileUsage)
+		fmt.Fprintf(os.Stdout, "     --automation-drift %v\n", automationDriftUsage)
+		fmt.Fprintf(os.Stdout, "     --threshold-per-host %v\n", thresholdPerHostUsage)
+		fmt.Fprintf(os.Stdout, "     --from-alert-config %v\n", fromAlertConfigUsage)
+		fmt.Fprintf(os.Stdout, "     --global-lock %v\n", globalLockUsage)
+		fmt.Fprintf(os.Stdout, "     --compact-perfdata %v\n", compactPerfDataUsage)
+		fmt.Fprintf(os.Stdout, "     --perfdata-precision (default: %v) %v\n", perfDataPrecisionDefault, perfDataPrecisionUsage)
+		fmt.Fprintf(os.Stdout, "     --active-window %v\n", activeWindowUsage)
+		fmt.Fprintf(os.Stdout, "     --probe-all-metrics %v\n", probeAllMetricsUsage)
+		fmt.Fprintf(os.Stdout, "     --concurrency (default: %v) %v\n", concurrencyDefault, concurrencyUsage)
+		fmt.Fprintf(os.Stdout, "     --cursors %v\n", cursorsUsage)
+		fmt.Fprintf(os.Stdout, "     --warn-on-deprecation %v\n", warnOnDeprecationUsage)
+		fmt.Fprintf(os.Stdout, "     --cert-expiry %v\n", certExpiryUsage)
+		fmt.Fprintf(os.Stdout, "     --warn-days (default: %v) %v\n", warnDaysDefault, warnDaysUsage)
+		fmt.Fprintf(os.Stdout, "     --crit-days (default: %v) %v\n", critDaysDefault, critDaysUsage)
+		fmt.Fprintf(os.Stdout, "     --min-healthy-percent (default: %v) %v\n", minHealthyPercentDefault, minHealthyPercentUsage)
+		fmt.Fprintf(os.Stdout, "     --critical-healthy-percent (default: %v) %v\n", criticalHealthyPercentDefault, criticalHealthyPercentUsage)
+		fmt.Fprintf(os.Stdout, "     --color %v\n", colorUsage)
+		fmt.Fprintf(os.Stdout, "     --no-color %v\n", noColorUsage)
+		fmt.Fprintf(os.Stdout, "     --oplog-churn %v\n", oplogChurnUsage)
+		fmt.Fprintf(os.Stdout, "     --oplog-size %v\n", oplogSizeUsage)
+		fmt.Fprintf(os.Stdout, "     --no-dedupe %v\n", noDedupeUsage)
+		fmt.Fprintf(os.Stdout, "     --test-auth %v\n", testAuthUsage)
+		fmt.Fprintf(os.Stdout, "     --per-target-timeout (default: %v) %v\n", perTargetTimeoutDefault, perTargetTimeoutUsage)
+		fmt.Fprintf(os.Stdout, "     --scan-ratio %v\n", scanRatioUsage)
+		fmt.Fprintf(os.Stdout, "     --rate-limit %v\n", rateLimitUsage)
+		fmt.Fprintf(os.Stdout, "     --zscore %v\n", zScoreUsage)
+		fmt.Fprintf(os.Stdout, "     --staleness-source (default: %v) %v\n", stalenessSourceDefault, stalenessSourceUsage)
+		fmt.Fprintf(os.Stdout, "     --topology-ttl (default: %v) %v\n", topologyTTLDefault, topologyTTLUsage)
+		fmt.Fprintf(os.Stdout, "     --parameter %v\n", parameterUsage)
+		fmt.Fprintf(os.Stdout, "     --warn-on-redirect-host-mismatch %v\n", warnOnRedirectHostMismatchUsage)
+		fmt.Fprintf(os.Stdout, "     --strict-host %v\n", strictHostUsage)
+		fmt.Fprintf(os.Stdout, "     --database-count %v\n", databaseCountUsage)
+		fmt.Fprintf(os.Stdout, "     --explain %v\n", explainUsage)
+		fmt.Fprintf(os.Stdout, "     --trace-file %v\n", traceFileUsage)
+		fmt.Fprintf(os.Stdout, "     --grace-period %v\n", gracePeriodUsage)
+		fmt.Fprintf(os.Stdout, "     --otlp-endpoint (default: %v) %v\n", otlpEndpointDefault, otlpEndpointUsage)
+		fmt.Fprintf(os.Stdout, "     --value-field %v\n", valueFieldUsage)
+		fmt.Fprintf(os.Stdout, "     --summarize %v\n", summarizeUsage)
+		fmt.Fprintf(os.Stdout, "     --summarize-threshold (default: %v) %v\n", summarizeThresholdDefault, summarizeThresholdUsage)
+		fmt.Fprintf(os.Stdout, "     -f, --function (default: %v) %v\n", functionDefault, functionUsage)
+		fmt.Fprintf(os.Stdout, "     --retries (default: %v) %v\n", retriesDefault, retriesUsage)
+		fmt.Fprintf(os.Stdout, "     --list-metrics %v\n", listMetricsUsage)
+		fmt.Fprintf(os.Stdout, "     -x, --proxy %v\n", proxyUsage)
+		fmt.Fprintf(os.Stdout, "     --stale-status (default: %v) %v\n", staleStatusDefault, staleStatusUsage)
+		fmt.Fprintf(os.Stdout, "     --cluster %v\n", clusterUsage)
+		fmt.Fprintf(os.Stdout, "     --realm %v\n", realmUsage)
+		fmt.Fprintf(os.Stdout, "     --expect-type %v\n", expectTypeUsage)
+		fmt.Fprintf(os.Stdout, "     --rate %v\n", rateOfChangeUsage)
+		fmt.Fprintf(os.Stdout, "     --hostid %v\n", hostIdUsage)
+		fmt.Fprintf(os.Stdout, "     --check-alerts %v\n", checkAlertsUsage)
+		fmt.Fprintf(os.Stdout, "     --cafile %v\n", caFileUsage)
+		fmt.Fprintf(os.Stdout, "     --insecure %v\n", insecureUsage)
+		fmt.Fprintf(os.Stdout, "     --exact-counters %v\n", exactCountersUsage)
 		fmt.Fprintf(os.Stdout, "\n     -w and -c support the standard nagios threshold formats.\n"+
-			"     See https://nagios-plugins.org/doc/guidelines.html#THRESHOLDFORMAT for more details.\n")
+			"     See https://nagios-plugins.org/doc/guidelines.html#THRESHOLDFORMAT for more details.\n"+
+			"     For metric checks, values may use K, M, G, T or P size suffixes (e.g. 8G) for byte\n"+
+			"     metrics, or a %% suffix (e.g. 90%%) for percentage metrics.\n")
 	}
 	flag.Parse()
 }
@@ -0,0 +1,147 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"./model"
+	"./util"
+	"context"
+	"fmt"
+	"github.com/fractalcat/nagiosplugin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newConfigServersServer serves a sharded cluster whose host listing has an
+// old last ping for every host, while each host fetched on its own has the
+// last ping in pings, or is gone when it has none.
+func newConfigServersServer(listed *int32, pings map[string]time.Time) *httptest.Server {
+	old := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	types := map[string]string{"mongos": "SHARD_MONGOS", "c1": "SHARD_CONFIG", "c2": "SHARD_CONFIG", "s1": "SHARD_PRIMARY"}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/public/v1.0/groups/g1/hosts")
+		if path == "" {
+			atomic.AddInt32(listed, 1)
+			var hosts []string
+			for _, id := range []string{"mongos", "c1", "c2", "s1"} {
+				hosts = append(hosts, fmt.Sprintf(`{"id": "%v", "hostname": "%v", "port": 27017, "typeName": "%v", "clusterId": "cluster1", "parentClusterId": "cluster1", "lastPing": "%v"}`, id, id, types[id], old))
+			}
+			fmt.Fprintf(w, `{"results": [%v], "links": []}`, strings.Join(hosts, ", "))
+			return
+		}
+
+		id := strings.TrimPrefix(path, "/")
+		ping, ok := pings[id]
+		if ok == false {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"reason": "Not Found", "detail": "No host"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"id": "%v", "hostname": "%v", "port": 27017, "typeName": "%v", "parentClusterId": "cluster1", "lastPing": "%v"}`, id, id, types[id], ping.UTC().Format(time.RFC3339))
+	}))
+}
+
+// runConfigServersCheck runs --config-servers as a single run of the plugin.
+func runConfigServersCheck(t *testing.T, server *httptest.Server) *util.Report {
+	api, err := util.NewMMSAPI(server.URL, 5, "user", "key")
+	if err != nil {
+		t.Fatalf("NewMMSAPI: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	check := util.NewReport()
+	doConfigServersCheck(check, api.WithContext(ctx), &model.Host{Id: "mongos", TypeName: "SHARD_MONGOS", ClusterId: "cluster1"})
+	return check
+}
+
+func TestConfigServersTopologyCache(t *testing.T) {
+	groupId, hostname, maxAge, topologyTTL = "g1", "mongos", 60, 600
+	cache = util.LoadCache("")
+	defer func() { topologyTTL = 0 }()
+
+	var listed int32
+	pings := map[string]time.Time{"c1": time.Now(), "c2": time.Now().Add(-10 * time.Minute)}
+	server := newConfigServersServer(&listed, pings)
+	defer server.Close()
+
+	// The hosts are listed once, but their last ping comes from each run.
+	for run := 0; run < 2; run++ {
+		check := runConfigServersCheck(t, server)
+		if check.ExitStatus() != nagiosplugin.CRITICAL || !strings.Contains(check.Message(), "1 of 2 config servers") || !strings.Contains(check.Message(), "c2:27017") {
+			t.Errorf("run %v: %v - %v, want c2 critical", run, check.ExitStatus(), check.Message())
+		}
+	}
+	if got := atomic.LoadInt32(&listed); got != 1 {
+		t.Errorf("listed the hosts %v times, want once", got)
+	}
+
+	// A config server that is gone drops the cached topology.
+	delete(pings, "c2")
+	if check := runConfigServersCheck(t, server); check.ExitStatus() != nagiosplugin.UNKNOWN {
+		t.Errorf("gone config server: %v - %v, want UNKNOWN", check.ExitStatus(), check.Message())
+	}
+	runConfigServersCheck(t, server)
+	if got := atomic.LoadInt32(&listed); got != 2 {
+		t.Errorf("listed the hosts %v times, want again after the error", got)
+	}
+}
+
+func TestWiredTigerEviction(t *testing.T) {
+	groupId, wiredTiger, maxAge = "g1", "eviction", 600
+	defer func() { wiredTiger = "" }()
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	tests := []struct {
+		name       string
+		dataPoints string
+		status     nagiosplugin.Status
+		evicted    float64
+	}{
+		{"rate", fmt.Sprintf(`{"timestamp": "%v", "value": 0}, {"timestamp": "%v", "value": 120}`, now.Add(-time.Minute).Format(time.RFC3339), now.Format(time.RFC3339)), nagiosplugin.OK, 2 * 1024 * 1024},
+		{"single data point", fmt.Sprintf(`{"timestamp": "%v", "value": 120}`, now.Format(time.RFC3339)), nagiosplugin.UNKNOWN, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/public/v1.0/groups/g1/hosts/h1/metrics":
+					fmt.Fprint(w, `{"results": [{"metricName": "CACHE_BYTES_WRITTEN_FROM", "units": "MEGABYTES"}]}`)
+				case "/api/public/v1.0/groups/g1/hosts/h1/metrics/CACHE_BYTES_WRITTEN_FROM":
+					fmt.Fprintf(w, `{"metricName": "CACHE_BYTES_WRITTEN_FROM", "units": "MEGABYTES", "dataPoints": [%v]}`, test.dataPoints)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			api, err := util.NewMMSAPI(server.URL, 5, "user", "key")
+			if err != nil {
+				t.Fatalf("NewMMSAPI: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			check := util.NewReport()
+			doWiredTigerCheck(check, api.WithContext(ctx), &checkOptions{warning: "~:", critical: "~:"}, &model.Host{Id: "h1"})
+			if check.ExitStatus() != test.status {
+				t.Errorf("%v - %v, want %v", check.ExitStatus(), check.Message(), test.status)
+			}
+
+			if test.evicted < 0 {
+				return
+			}
+			if len(check.PerfData) != 1 || check.PerfData[0].Label != "cache_evicted" || check.PerfData[0].Unit != "" || check.PerfData[0].Value != test.evicted {
+				t.Errorf("perfdata = %+v, want cache_evicted of %v bytes per second without a unit", check.PerfData, test.evicted)
+			}
+		})
+	}
+}
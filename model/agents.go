@@ -0,0 +1,25 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+type AgentLogEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+}
+
+type AgentLogResponse struct {
+	Entries []AgentLogEntry `json:"results"`
+}
+
+func (entry *AgentLogEntry) IsError() bool {
+	level := strings.ToUpper(entry.Level)
+	return level == "ERROR" || level == "FATAL"
+}
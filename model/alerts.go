@@ -0,0 +1,52 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package model
+
+type AlertConfig struct {
+	Id              string           `json:"id"`
+	EventTypeName   string           `json:"eventTypeName"`
+	Enabled         bool             `json:"enabled"`
+	MetricThreshold *MetricThreshold `json:"metricThreshold"`
+}
+
+type MetricThreshold struct {
+	MetricName string  `json:"metricName"`
+	Operator   string  `json:"operator"`
+	Threshold  float64 `json:"threshold"`
+	Units      string  `json:"units"`
+}
+
+// Alert is an alert raised by Ops Manager, such as HOST_DOWN. HostId is only
+// set for alerts about a host.
+type Alert struct {
+	Id              string `json:"id"`
+	EventTypeName   string `json:"eventTypeName"`
+	Status          string `json:"status"`
+	HostId          string `json:"hostId"`
+	HostnameAndPort string `json:"hostnameAndPort"`
+	MetricName      string `json:"metricName"`
+}
+
+type AlertsResponse struct {
+	Page
+	Alerts []Alert `json:"results"`
+}
+
+type AlertConfigsResponse struct {
+	Page
+	AlertConfigs []AlertConfig `json:"results"`
+}
+
+// MetricAlertConfig returns the first enabled metric threshold alert config
+// for the named metric, or nil if there is none.
+func (response *AlertConfigsResponse) MetricAlertConfig(metricName string) *AlertConfig {
+	for i, config := range response.AlertConfigs {
+		if config.Enabled && config.MetricThreshold != nil && config.MetricThreshold.MetricName == metricName {
+			return &response.AlertConfigs[i]
+		}
+	}
+
+	return nil
+}
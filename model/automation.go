@@ -0,0 +1,112 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package model
+
+import (
+	"strings"
+)
+
+type AutomationConfig struct {
+	ReplicaSets []ReplicaSetConfig `json:"replicaSets"`
+	Processes   []ProcessConfig    `json:"processes"`
+}
+
+// ProcessConfig is the goal configuration of a single mongod or mongos. Its
+// startup options are kept as nested maps, as in a mongod config file.
+type ProcessConfig struct {
+	Name     string                 `json:"name"`
+	Hostname string                 `json:"hostname"`
+	Args     map[string]interface{} `json:"args2_6"`
+}
+
+type ReplicaSetConfig struct {
+	Id      string                   `json:"_id"`
+	Members []ReplicaSetMemberConfig `json:"members"`
+}
+
+type ReplicaSetMemberConfig struct {
+	Id          int     `json:"_id"`
+	Host        string  `json:"host"`
+	Votes       int     `json:"votes"`
+	Priority    float64 `json:"priority"`
+	ArbiterOnly bool    `json:"arbiterOnly"`
+	Hidden      bool    `json:"hidden"`
+}
+
+func (config *AutomationConfig) ReplicaSet(name string) *ReplicaSetConfig {
+	for i := range config.ReplicaSets {
+		if config.ReplicaSets[i].Id == name {
+			return &config.ReplicaSets[i]
+		}
+	}
+
+	return nil
+}
+
+// Process returns the goal configuration of the process on hostname and
+// port, or nil if automation does not manage it.
+func (config *AutomationConfig) Process(hostname string, port int) *ProcessConfig {
+	for i := range config.Processes {
+		process := &config.Processes[i]
+		processPort, _ := LookupOption(process.Args, "net.port")
+		if process.Hostname == hostname && processPort == float64(port) {
+			return process
+		}
+	}
+
+	return nil
+}
+
+// LookupOption finds a startup option by its dotted name, such as
+// storage.wiredTiger.engineConfig.cacheSizeGB, in nested options.
+func LookupOption(options map[string]interface{}, name string) (interface{}, bool) {
+	parts := strings.Split(name, ".")
+	for _, part := range parts[:len(parts)-1] {
+		nested, ok := options[part].(map[string]interface{})
+		if ok == false {
+			return nil, false
+		}
+		options = nested
+	}
+
+	value, ok := options[parts[len(parts)-1]]
+	return value, ok
+}
+
+func (replicaSet *ReplicaSetConfig) Voters() int {
+	voters := 0
+	for _, member := range replicaSet.Members {
+		if member.Votes > 0 {
+			voters++
+		}
+	}
+
+	return voters
+}
+
+// AutomationStatus is the goal automation config version of a group and the
+// version each process last reached.
+type AutomationStatus struct {
+	GoalVersion int                 `json:"goalVersion"`
+	Processes   []AutomationProcess `json:"processes"`
+}
+
+type AutomationProcess struct {
+	Name                    string `json:"name"`
+	Hostname                string `json:"hostname"`
+	LastGoalVersionAchieved int    `json:"lastGoalVersionAchieved"`
+}
+
+// Lagging returns the processes that have not reached the goal version.
+func (status *AutomationStatus) Lagging() []AutomationProcess {
+	var lagging []AutomationProcess
+	for _, process := range status.Processes {
+		if process.LastGoalVersionAchieved < status.GoalVersion {
+			lagging = append(lagging, process)
+		}
+	}
+
+	return lagging
+}
@@ -0,0 +1,18 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package model
+
+// DeploymentHealth is the rolled-up health of a group's deployment, as
+// reported by the Ops Manager versions that provide it.
+type DeploymentHealth struct {
+	Status     string            `json:"status"`
+	Subsystems []SubsystemHealth `json:"subsystems"`
+}
+
+type SubsystemHealth struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
@@ -5,14 +5,153 @@
 package model
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 )
 
 type Host struct {
-	Id       string    `json:"id"`
-	LastPing time.Time `json:"lastPing"`
+	Id               string    `json:"id"`
+	Hostname         string    `json:"hostname"`
+	Port             int       `json:"port"`
+	ReplicaSetName   string    `json:"replicaSetName"`
+	ReplicaStateName string    `json:"replicaStateName"`
+	TypeName         string    `json:"typeName"`
+	ClusterId        string    `json:"clusterId"`
+	ParentClusterId  string    `json:"parentClusterId"`
+	ShardName        string    `json:"shardName"`
+	Hidden           bool      `json:"hidden"`
+	HiddenSecondary  bool      `json:"hiddenSecondary"`
+	HostEnabled      *bool     `json:"hostEnabled"`
+	LastPing         time.Time `json:"lastPing"`
+	Created          time.Time `json:"created"`
+}
+
+// UnmarshalJSON also accepts the field names used by other API versions, so
+// that a host is not silently parsed with empty fields on a version mismatch.
+func (host *Host) UnmarshalJSON(data []byte) error {
+	type hostFields Host
+	var raw struct {
+		hostFields
+		ReplSetName  string    `json:"replSetName"`
+		ReplState    string    `json:"replicaState"`
+		Type         string    `json:"type"`
+		LastPingTime time.Time `json:"lastPingTime"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*host = Host(raw.hostFields)
+	if host.ReplicaSetName == "" {
+		host.ReplicaSetName = raw.ReplSetName
+	}
+	if host.ReplicaStateName == "" {
+		host.ReplicaStateName = raw.ReplState
+	}
+	if host.TypeName == "" {
+		host.TypeName = raw.Type
+	}
+	if host.LastPing.IsZero() {
+		host.LastPing = raw.LastPingTime
+	}
+
+	return nil
+}
+
+// ShardChunks is the number of chunks a shard of a sharded cluster holds.
+type ShardChunks struct {
+	ShardName string `json:"shardName"`
+	Chunks    int    `json:"chunkCount"`
+}
+
+type ShardChunksResponse struct {
+	Shards []ShardChunks `json:"results"`
+}
+
+// Link is a link to a related resource, such as the next page of a list.
+type Link struct {
+	Rel  string `json:"rel"`
+	Href string `json:"href"`
+}
+
+// Cluster is a replica set or sharded cluster of the group. The hosts of a
+// replica set refer to it by ClusterId, and the hosts of a sharded cluster by
+// ParentClusterId.
+type Cluster struct {
+	Id             string `json:"id"`
+	ClusterName    string `json:"clusterName"`
+	TypeName       string `json:"typeName"`
+	ReplicaSetName string `json:"replicaSetName"`
+	ShardName      string `json:"shardName"`
+}
+
+type ClustersResponse struct {
+	Clusters []Cluster `json:"results"`
+}
+
+// Page holds the links of a page of a paginated list.
+type Page struct {
+	Links []Link `json:"links"`
+}
+
+// Next is the URL of the next page of the list, or empty on the last page.
+func (page *Page) Next() string {
+	for _, link := range page.Links {
+		if link.Rel == "next" {
+			return link.Href
+		}
+	}
+
+	return ""
 }
 
 type HostsResponse struct {
+	Page
 	Hosts []Host `json:"results"`
 }
+
+// Name is the hostname and port of the host, or its ID when only the ID is
+// known.
+func (host *Host) Name() string {
+	if host.Hostname == "" {
+		return host.Id
+	}
+
+	return fmt.Sprintf("%v:%v", host.Hostname, host.Port)
+}
+
+// ShortName is the hostname without its domain, or the ID when only the ID
+// is known.
+func (host *Host) ShortName() string {
+	if host.Hostname == "" {
+		return host.Id
+	}
+
+	return strings.SplitN(host.Hostname, ".", 2)[0]
+}
+
+// IsShardMember reports whether the host is a data bearing member of a shard,
+// as opposed to a mongos or a config server.
+func (host *Host) IsShardMember() bool {
+	return host.TypeName == "SHARD_PRIMARY" || host.TypeName == "SHARD_SECONDARY" || host.TypeName == "SHARD_STANDALONE"
+}
+
+// IsConfigServer reports whether the host is a config server of a sharded
+// cluster.
+func (host *Host) IsConfigServer() bool {
+	return strings.HasPrefix(host.TypeName, "SHARD_CONFIG")
+}
+
+// MonitoringDisabled reports whether monitoring is turned off for the host.
+// Versions that do not say are assumed to monitor it.
+func (host *Host) MonitoringDisabled() bool {
+	return host.HostEnabled != nil && !*host.HostEnabled
+}
+
+// IsHidden reports whether the host is a hidden replica set member, which
+// legitimately does not serve reads and may report less often.
+func (host *Host) IsHidden() bool {
+	return host.Hidden || host.HiddenSecondary
+}
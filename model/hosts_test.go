@@ -0,0 +1,66 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHostFieldNamesAcrossVersions(t *testing.T) {
+	tests := []struct {
+		version string
+		fixture string
+	}{
+		{"current", `{
+			"id": "22b3c8f1e4b0c3a2",
+			"hostname": "db1.example.com",
+			"port": 27017,
+			"replicaSetName": "rs0",
+			"replicaStateName": "PRIMARY",
+			"typeName": "REPLICA_PRIMARY",
+			"lastPing": "2015-03-05T10:00:00Z"
+		}`},
+		{"older", `{
+			"id": "22b3c8f1e4b0c3a2",
+			"hostname": "db1.example.com",
+			"port": 27017,
+			"replSetName": "rs0",
+			"replicaState": "PRIMARY",
+			"type": "REPLICA_PRIMARY",
+			"lastPingTime": "2015-03-05T10:00:00Z"
+		}`},
+	}
+
+	lastPing := time.Date(2015, 3, 5, 10, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		host := &Host{}
+		if err := json.Unmarshal([]byte(test.fixture), host); err != nil {
+			t.Fatalf("%v: %v", test.version, err)
+		}
+
+		if host.Id != "22b3c8f1e4b0c3a2" || host.Hostname != "db1.example.com" || host.Port != 27017 {
+			t.Errorf("%v: identity not parsed: %+v", test.version, host)
+		}
+		if host.ReplicaSetName != "rs0" || host.ReplicaStateName != "PRIMARY" || host.TypeName != "REPLICA_PRIMARY" {
+			t.Errorf("%v: replica set fields not parsed: %+v", test.version, host)
+		}
+		if !host.LastPing.Equal(lastPing) {
+			t.Errorf("%v: LastPing = %v, want %v", test.version, host.LastPing, lastPing)
+		}
+	}
+}
+
+func TestHostCurrentFieldNamesWin(t *testing.T) {
+	host := &Host{}
+	if err := json.Unmarshal([]byte(`{"replicaSetName": "new", "replSetName": "old"}`), host); err != nil {
+		t.Fatal(err)
+	}
+
+	if host.ReplicaSetName != "new" {
+		t.Errorf("ReplicaSetName = %v, want new", host.ReplicaSetName)
+	}
+}
@@ -5,7 +5,13 @@
 package model
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,28 +21,151 @@ type Metric struct {
 	DataPoints []DataPoint `json:"dataPoints"`
 }
 
+// UnmarshalJSON also accepts the field names used by other API versions, so
+// that a metric is not silently parsed without its data points on a version
+// mismatch.
+func (metric *Metric) UnmarshalJSON(data []byte) error {
+	type metricFields Metric
+	var raw struct {
+		metricFields
+		Name   string      `json:"name"`
+		Unit   string      `json:"unit"`
+		Points []DataPoint `json:"points"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*metric = Metric(raw.metricFields)
+	if metric.MetricName == "" {
+		metric.MetricName = raw.Name
+	}
+	if metric.Units == "" {
+		metric.Units = raw.Unit
+	}
+	if metric.DataPoints == nil {
+		metric.DataPoints = raw.Points
+	}
+
+	return nil
+}
+
+// MetricSummary describes a metric that is available for a host, as listed
+// by the metrics endpoint.
+type MetricSummary struct {
+	MetricName string `json:"metricName"`
+	Units      string `json:"units"`
+}
+
+type MetricsResponse struct {
+	Metrics []MetricSummary `json:"results"`
+}
+
+type Database struct {
+	DatabaseName string `json:"databaseName"`
+}
+
+type DatabasesResponse struct {
+	Databases []Database `json:"results"`
+}
+
 type DataPoint struct {
 	Timestamp time.Time `json:"timestamp"`
 	Value     float64   `json:"value"`
+	// Number is the value exactly as the API sent it, which for very large
+	// counters holds more precision than Value.
+	Number json.Number `json:"-"`
+	// Null is set when the data point was collected but carried no value,
+	// in which case Value is zero.
+	Null bool `json:"-"`
+	// Fields holds the sub-values of a measurement whose value is an object
+	// rather than a number, such as a histogram. The data point is Null
+	// until one of them is chosen with Metric.SelectField.
+	Fields map[string]*json.Number `json:"-"`
+}
+
+func (dataPoint *DataPoint) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Timestamp time.Time       `json:"timestamp"`
+		Value     json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	dataPoint.Timestamp = raw.Timestamp
+	dataPoint.Null = true
+
+	value := strings.TrimSpace(string(raw.Value))
+	if strings.HasPrefix(value, "{") {
+		return json.Unmarshal(raw.Value, &dataPoint.Fields)
+	}
+
+	var number *json.Number
+	if value != "" {
+		if err := json.Unmarshal(raw.Value, &number); err != nil {
+			return err
+		}
+	}
+	dataPoint.setNumber(number)
+
+	return nil
+}
+
+func (dataPoint *DataPoint) setNumber(number *json.Number) {
+	dataPoint.Null = number == nil
+	dataPoint.Number = ""
+	dataPoint.Value = 0
+	if number != nil {
+		dataPoint.Number = *number
+		dataPoint.Value, _ = number.Float64()
+	}
+}
+
+// Sub returns the difference between two data points. Integer values are
+// subtracted exactly, so that the delta of a counter beyond the exact integer
+// range of a float64 does not lose precision.
+func (dataPoint *DataPoint) Sub(other DataPoint) float64 {
+	a, okA := new(big.Int).SetString(string(dataPoint.Number), 10)
+	b, okB := new(big.Int).SetString(string(other.Number), 10)
+	if okA && okB {
+		delta, _ := new(big.Float).SetInt(a.Sub(a, b)).Float64()
+		return delta
+	}
+
+	return dataPoint.Value - other.Value
 }
 
 var metricUnits = map[string]string{
-	"RAW":          "",
-	"BITS":         "b",
-	"BYTES":        "B",
-	"KILOBITS":     "kb",
-	"KILOBYTES":    "KB",
-	"MEGABITS":     "mb",
-	"MEGABYTES":    "MB",
-	"GIGABITS":     "gb",
-	"GIGABYTES":    "GB",
-	"TERABYTES":    "TB",
-	"PETABYTES":    "PB",
-	"MILLISECONDS": "ms",
-	"SECONDS":      "secs",
-	"MINUTES":      "mins",
-	"HOURS":        "hours",
-	"DAYS":         "days",
+	"RAW":               "",
+	"BITS":              "b",
+	"BYTES":             "B",
+	"KILOBITS":          "kb",
+	"KILOBYTES":         "KB",
+	"MEGABITS":          "mb",
+	"MEGABYTES":         "MB",
+	"GIGABITS":          "gb",
+	"GIGABYTES":         "GB",
+	"TERABYTES":         "TB",
+	"PETABYTES":         "PB",
+	"MILLISECONDS":      "ms",
+	"SECONDS":           "secs",
+	"MINUTES":           "mins",
+	"HOURS":             "hours",
+	"DAYS":              "days",
+	"PERCENT":           "%",
+	"SCALAR_PER_SECOND": "/s",
+}
+
+// FormatValue formats a value of a metric measured in units with the short
+// form of the units, e.g. "432 MB".
+func FormatValue(value float64, units string) string {
+	unit := metricUnits[units]
+	if unit == "" {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return fmt.Sprintf("%v %v", value, unit)
 }
 
 var metricFormaters = map[string]string{
@@ -63,6 +192,7 @@ var metricFormaters = map[string]string{
 	"INDEX_COUNTERS_BTREE_HITS":           "%v btree hits per second",
 	"INDEX_COUNTERS_BTREE_MISSES":         "%v btree misses per second",
 	"INDEX_COUNTERS_BTREE_MISS_RATIO":     "%v btree miss ratio",
+	"INDEX_BUILDS":                        "%v index builds in progress",
 	"JOURNALING_COMMITS_IN_WRITE_LOCK":    "%v journal commits in write lock",
 	"JOURNALING_MB":                       "%v megabytes writen to journal per second",
 	"MEMORY_MAPPED":                       "%v megabytes of mapped datafiles",
@@ -85,6 +215,12 @@ var metricFormaters = map[string]string{
 	"OPLOG_MASTER_LAG_TIME_DIFF":          "%v seconds of replication headroom",
 }
 
+// IsCumulative reports whether the metric is described as a count since the
+// process started, rather than a rate or a current value.
+func IsCumulative(metricName string) bool {
+	return strings.HasSuffix(metricFormaters[metricName], " since process started")
+}
+
 func (metric *Metric) ToStringLastDataPoint() string {
 	if len(metric.DataPoints) == 0 {
 		return "Metric has no datapoints"
@@ -93,10 +229,165 @@ func (metric *Metric) ToStringLastDataPoint() string {
 	return metric.ToStringDataPoint(len(metric.DataPoints) - 1)
 }
 
+// LastNonNullIndex returns the index of the last data point that has a
+// value, or -1 if there is none.
+func (metric *Metric) LastNonNullIndex() int {
+	for i := len(metric.DataPoints) - 1; i >= 0; i-- {
+		if !metric.DataPoints[i].Null {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// FieldNames returns the names of the sub-values of structured data points,
+// or nil if every data point is a plain number.
+func (metric *Metric) FieldNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, dataPoint := range metric.DataPoints {
+		for name := range dataPoint.Fields {
+			if seen[name] == false {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// SelectField makes the named sub-value the value of each structured data
+// point. Data points without it become null.
+func (metric *Metric) SelectField(name string) error {
+	if metric.FieldNames() == nil {
+		return errors.New(fmt.Sprintf("Data points of %v are plain numbers without sub-values", metric.MetricName))
+	}
+
+	for i := range metric.DataPoints {
+		metric.DataPoints[i].setNumber(metric.DataPoints[i].Fields[name])
+	}
+
+	return nil
+}
+
+// Dedupe drops data points with the same timestamp as an earlier one, keeping
+// the value of the last of them in the place of the first, so that duplicates
+// are not counted twice by sums and averages.
+func (metric *Metric) Dedupe() {
+	seen := map[int64]int{}
+	deduped := metric.DataPoints[:0]
+	for _, dataPoint := range metric.DataPoints {
+		if i, ok := seen[dataPoint.Timestamp.UnixNano()]; ok {
+			deduped[i] = dataPoint
+			continue
+		}
+
+		seen[dataPoint.Timestamp.UnixNano()] = len(deduped)
+		deduped = append(deduped, dataPoint)
+	}
+
+	metric.DataPoints = deduped
+}
+
+// RoundValues replaces the exact values of the data points, including their
+// sub-values, with their float64 values, so that Sub is no more precise than
+// subtracting the values.
+func (metric *Metric) RoundValues() {
+	round := func(number json.Number) json.Number {
+		value, err := number.Float64()
+		if err != nil {
+			return number
+		}
+		return json.Number(strconv.FormatFloat(value, 'f', -1, 64))
+	}
+
+	for i := range metric.DataPoints {
+		dataPoint := &metric.DataPoints[i]
+		if dataPoint.Number != "" {
+			dataPoint.Number = round(dataPoint.Number)
+		}
+		for _, field := range dataPoint.Fields {
+			if field != nil {
+				*field = round(*field)
+			}
+		}
+	}
+}
+
+// Values returns the values of the data points that have one.
+func (metric *Metric) Values() []float64 {
+	var values []float64
+	for _, dataPoint := range metric.DataPoints {
+		if !dataPoint.Null {
+			values = append(values, dataPoint.Value)
+		}
+	}
+
+	return values
+}
+
+// Increase returns how much a counter metric went up over its data points.
+// Only increases between consecutive values are counted, so that a counter
+// reset by a restart does not subtract from the total.
+func (metric *Metric) Increase() float64 {
+	increase := 0.0
+	var previous *DataPoint
+	for i := range metric.DataPoints {
+		dataPoint := &metric.DataPoints[i]
+		if dataPoint.Null {
+			continue
+		}
+
+		if previous != nil {
+			if delta := dataPoint.Sub(*previous); delta > 0 {
+				increase += delta
+			}
+		}
+		previous = dataPoint
+	}
+
+	return increase
+}
+
+// Rate returns the per second rate at which a counter metric went up over its
+// data points, divided by the time actually elapsed between the first and last
+// value rather than an interval assumed from the granularity. regular reports
+// whether the values were sampled at even intervals.
+func (metric *Metric) Rate() (rate float64, regular bool) {
+	var timestamps []time.Time
+	for _, dataPoint := range metric.DataPoints {
+		if !dataPoint.Null {
+			timestamps = append(timestamps, dataPoint.Timestamp)
+		}
+	}
+
+	if len(timestamps) < 2 {
+		return 0, false
+	}
+
+	regular = true
+	interval := timestamps[1].Sub(timestamps[0])
+	for i := 2; i < len(timestamps); i++ {
+		if timestamps[i].Sub(timestamps[i-1]) != interval {
+			regular = false
+		}
+	}
+
+	elapsed := timestamps[len(timestamps)-1].Sub(timestamps[0]).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+
+	return metric.Increase() / elapsed, regular
+}
+
 func (metric *Metric) ToStringDataPoint(index int) string {
 	metricFormater, ok := metricFormaters[metric.MetricName]
 	if ok == false {
-		return fmt.Sprintf("%v %v %v", metric.MetricName, metric.DataPoints[index].Value, metricUnits[metric.Units])
+		return fmt.Sprintf("%v %v", metric.MetricName, FormatValue(metric.DataPoints[index].Value, metric.Units))
 	}
 
 	return fmt.Sprintf(metricFormater, metric.DataPoints[index].Value)
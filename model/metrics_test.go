@@ -0,0 +1,214 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// parseMetric unmarshals a metric fixture, failing the test if it is invalid.
+func parseMetric(t *testing.T, fixture string) *Metric {
+	metric := &Metric{}
+	if err := json.Unmarshal([]byte(fixture), metric); err != nil {
+		t.Fatalf("failed to parse fixture: %v", err)
+	}
+
+	return metric
+}
+
+// A counter beyond 2^53, where consecutive integers cannot all be held by a
+// float64.
+const largeCounterFixture = `{
+	"metricName": "OPCOUNTER_QUERY",
+	"units": "RAW",
+	"dataPoints": [
+		{"timestamp": "2015-03-05T10:00:00Z", "value": 9007199254740993},
+		{"timestamp": "2015-03-05T10:01:00Z", "value": 9007199254740995},
+		{"timestamp": "2015-03-05T10:02:00Z", "value": 9007199254741000}
+	]
+}`
+
+func TestLargeCounterPrecision(t *testing.T) {
+	tests := []struct {
+		name     string
+		round    bool
+		delta    float64
+		increase float64
+		rate     float64
+	}{
+		{"exact", false, 2, 7, 7.0 / 120},
+		{"rounded", true, 4, 8, 8.0 / 120},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metric := parseMetric(t, largeCounterFixture)
+			if test.round {
+				metric.RoundValues()
+			}
+
+			if got := metric.DataPoints[1].Sub(metric.DataPoints[0]); got != test.delta {
+				t.Errorf("Sub = %v, want %v", got, test.delta)
+			}
+			if got := metric.Increase(); got != test.increase {
+				t.Errorf("Increase = %v, want %v", got, test.increase)
+			}
+			if got, _ := metric.Rate(); got != test.rate {
+				t.Errorf("Rate = %v, want %v", got, test.rate)
+			}
+		})
+	}
+}
+
+func TestSubNonInteger(t *testing.T) {
+	metric := parseMetric(t, `{"dataPoints": [
+		{"timestamp": "2015-03-05T10:00:00Z", "value": 1.5},
+		{"timestamp": "2015-03-05T10:01:00Z", "value": 4}
+	]}`)
+
+	if got := metric.DataPoints[1].Sub(metric.DataPoints[0]); got != 2.5 {
+		t.Errorf("Sub = %v, want 2.5", got)
+	}
+}
+
+func TestMetricFieldNamesAcrossVersions(t *testing.T) {
+	tests := []struct {
+		version string
+		fixture string
+	}{
+		{"current", `{
+			"metricName": "CONNECTIONS",
+			"units": "SCALAR",
+			"dataPoints": [
+				{"timestamp": "2015-03-05T10:00:00Z", "value": 10},
+				{"timestamp": "2015-03-05T10:01:00Z", "value": 12}
+			]
+		}`},
+		{"older", `{
+			"name": "CONNECTIONS",
+			"unit": "SCALAR",
+			"points": [
+				{"timestamp": "2015-03-05T10:00:00Z", "value": 10},
+				{"timestamp": "2015-03-05T10:01:00Z", "value": 12}
+			]
+		}`},
+	}
+
+	for _, test := range tests {
+		metric := parseMetric(t, test.fixture)
+		if metric.MetricName != "CONNECTIONS" || metric.Units != "SCALAR" {
+			t.Errorf("%v: name and units not parsed: %+v", test.version, metric)
+		}
+		if len(metric.DataPoints) != 2 || metric.DataPoints[1].Value != 12 {
+			t.Errorf("%v: data points not parsed: %+v", test.version, metric.DataPoints)
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	// The data point at 10:01 is repeated, as across the boundary of two
+	// pages, with a later value.
+	metric := parseMetric(t, `{
+		"metricName": "CONNECTIONS",
+		"dataPoints": [
+			{"timestamp": "2015-03-05T10:00:00Z", "value": 10},
+			{"timestamp": "2015-03-05T10:01:00Z", "value": 20},
+			{"timestamp": "2015-03-05T10:01:00Z", "value": 25},
+			{"timestamp": "2015-03-05T10:02:00Z", "value": 30}
+		]
+	}`)
+
+	tests := []struct {
+		name   string
+		dedupe bool
+		values []float64
+		sum    float64
+	}{
+		{"deduplicated", true, []float64{10, 25, 30}, 65},
+		{"kept", false, []float64{10, 20, 25, 30}, 85},
+	}
+
+	for _, test := range tests {
+		copied := *metric
+		copied.DataPoints = append([]DataPoint{}, metric.DataPoints...)
+		if test.dedupe {
+			copied.Dedupe()
+		}
+
+		values := copied.Values()
+		if len(values) != len(test.values) {
+			t.Fatalf("%v: values = %v, want %v", test.name, values, test.values)
+		}
+
+		sum := 0.0
+		for i, value := range values {
+			if value != test.values[i] {
+				t.Errorf("%v: values = %v, want %v", test.name, values, test.values)
+			}
+			sum += value
+		}
+		if sum != test.sum {
+			t.Errorf("%v: sum = %v, want %v", test.name, sum, test.sum)
+		}
+	}
+}
+
+func TestScalarAndStructuredDataPoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		field   string
+		fields  []string
+		values  []float64
+		nulls   []bool
+	}{
+		{"scalar", `{"dataPoints": [
+			{"timestamp": "2015-03-05T10:00:00Z", "value": 1.5},
+			{"timestamp": "2015-03-05T10:01:00Z", "value": null},
+			{"timestamp": "2015-03-05T10:02:00Z", "value": 3}
+		]}`, "", nil, []float64{1.5, 0, 3}, []bool{false, true, false}},
+		{"structured", `{"dataPoints": [
+			{"timestamp": "2015-03-05T10:00:00Z", "value": {"p50": 2, "p99": 40}},
+			{"timestamp": "2015-03-05T10:01:00Z", "value": {"p50": 3}},
+			{"timestamp": "2015-03-05T10:02:00Z", "value": {"p50": 4, "p99": null}},
+			{"timestamp": "2015-03-05T10:03:00Z", "value": {"p50": 5, "p99": 60}}
+		]}`, "p99", []string{"p50", "p99"}, []float64{40, 0, 0, 60}, []bool{false, true, true, false}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metric := parseMetric(t, test.fixture)
+
+			fields := metric.FieldNames()
+			if len(fields) != len(test.fields) {
+				t.Fatalf("FieldNames = %v, want %v", fields, test.fields)
+			}
+			for i := range fields {
+				if fields[i] != test.fields[i] {
+					t.Errorf("FieldNames = %v, want %v", fields, test.fields)
+				}
+			}
+
+			if test.field != "" {
+				// Structured data points have no value until one is chosen.
+				if metric.LastNonNullIndex() >= 0 {
+					t.Errorf("structured data points have a value before SelectField")
+				}
+				if err := metric.SelectField(test.field); err != nil {
+					t.Fatalf("SelectField: %v", err)
+				}
+			} else if err := metric.SelectField("p99"); err == nil {
+				t.Errorf("SelectField on scalar data points did not fail")
+			}
+
+			for i, dataPoint := range metric.DataPoints {
+				if dataPoint.Value != test.values[i] || dataPoint.Null != test.nulls[i] {
+					t.Errorf("data point %v = %v (null %v), want %v (null %v)", i, dataPoint.Value, dataPoint.Null, test.values[i], test.nulls[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Aggregate combines values using the named function: sum, min, max, avg or
+// p95.
+func Aggregate(function string, values []float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, errors.New("No values to aggregate")
+	}
+
+	result := values[0]
+	switch function {
+	case "sum", "avg":
+		for _, value := range values[1:] {
+			result += value
+		}
+		if function == "avg" {
+			result /= float64(len(values))
+		}
+	case "min":
+		for _, value := range values[1:] {
+			if value < result {
+				result = value
+			}
+		}
+	case "max":
+		for _, value := range values[1:] {
+			if value > result {
+				result = value
+			}
+		}
+	case "p95":
+		result = percentile(values, 95)
+	default:
+		return 0, errors.New(fmt.Sprintf("Unknown aggregation function %v", function))
+	}
+
+	return result, nil
+}
+
+// percentile returns the nearest-rank percentile of values.
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// MeanStdDev returns the mean and the population standard deviation of
+// values.
+func MeanStdDev(values []float64) (mean float64, stdDev float64, err error) {
+	mean, err = Aggregate("avg", values)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, value := range values {
+		stdDev += (value - mean) * (value - mean)
+	}
+
+	return mean, math.Sqrt(stdDev / float64(len(values))), nil
+}
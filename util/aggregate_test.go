@@ -0,0 +1,87 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		function string
+		values   []float64
+		want     float64
+		valid    bool
+	}{
+		// Connections across the members of a shard.
+		{"sum", []float64{120, 80, 100}, 300, true},
+		{"avg", []float64{120, 80, 100}, 100, true},
+		{"min", []float64{120, 80, 100}, 80, true},
+		{"max", []float64{120, 80, 100}, 120, true},
+
+		// A single host aggregates to its own value.
+		{"sum", []float64{42}, 42, true},
+		{"avg", []float64{42}, 42, true},
+		{"max", []float64{42}, 42, true},
+		{"p95", []float64{42}, 42, true},
+
+		// Negative values, such as a counter that was reset.
+		{"sum", []float64{-5, 5}, 0, true},
+		{"min", []float64{-5, 5}, -5, true},
+		{"max", []float64{-10, -5}, -5, true},
+
+		// The nearest rank of 95 of 20 values is the 19th, whatever their
+		// order.
+		{"p95", []float64{20, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, 19, true},
+		{"p95", []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 10, true},
+
+		{"sum", nil, 0, false},
+		{"median", []float64{1, 2}, 0, false},
+		{"worst", []float64{1, 2}, 0, false},
+	}
+
+	for _, test := range tests {
+		got, err := Aggregate(test.function, test.values)
+		if test.valid && (err != nil || got != test.want) {
+			t.Errorf("Aggregate(%q, %v) = %v, %v, want %v", test.function, test.values, got, err, test.want)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Aggregate(%q, %v) = %v, want an error", test.function, test.values, got)
+		}
+	}
+}
+
+func TestAggregateDoesNotReorderValues(t *testing.T) {
+	values := []float64{3, 1, 2}
+	Aggregate("p95", values)
+
+	if values[0] != 3 || values[1] != 1 || values[2] != 2 {
+		t.Errorf("Aggregate reordered its values to %v", values)
+	}
+}
+
+func TestMeanStdDev(t *testing.T) {
+	tests := []struct {
+		values []float64
+		mean   float64
+		stdDev float64
+	}{
+		{[]float64{5}, 5, 0},
+		{[]float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, 2},
+		{[]float64{1, 1, 1}, 1, 0},
+	}
+
+	for _, test := range tests {
+		mean, stdDev, err := MeanStdDev(test.values)
+		if err != nil || mean != test.mean || math.Abs(stdDev-test.stdDev) > 1e-9 {
+			t.Errorf("MeanStdDev(%v) = %v, %v, %v, want %v, %v", test.values, mean, stdDev, err, test.mean, test.stdDev)
+		}
+	}
+
+	if _, _, err := MeanStdDev(nil); err == nil {
+		t.Errorf("MeanStdDev(nil) did not fail")
+	}
+}
@@ -6,6 +6,9 @@ package util
 
 import (
 	"../model"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,13 +17,90 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 )
 
+// APIError is returned when the API responds with a non-200 status code.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *APIError) Error() string {
+	return err.Message
+}
+
+// RedirectError is the error of a request whose redirect to a host other than
+// the one requested was refused after SetStrictHost.
+type RedirectError struct {
+	From string
+	To   string
+}
+
+func (err *RedirectError) Error() string {
+	return fmt.Sprintf("Refused redirect from %v to %v, a different host", err.From, err.To)
+}
+
+// IsNotFound reports whether err is an APIError for a 404 response.
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == 404
+}
+
+// The number of retries of a transient failure by default, and the wait
+// before the first of them, which doubles for each further retry.
+const (
+	defaultRetries = 2
+	retryBackoff   = 200 * time.Millisecond
+)
+
 type MMSAPI struct {
-	client   *http.Client
-	hostname string
+	client    *http.Client
+	digest    *Transport
+	transport *http.Transport
+	hostname  string
+	fallback  string
+	headers   http.Header
+
+	// Every request is bounded by ctx, which main gives the deadline of the
+	// whole run, so that retries and further pages cannot outlast it.
+	ctx context.Context
+
+	*apiState
+
+	keepDuplicates  bool
+	keepExactValues bool
+
+	// Transient failures are retried up to retries times, backing off
+	// exponentially, as long as the retry can still finish within timeout.
+	retries int
+	timeout time.Duration
+
+	// tokens is nil unless requests are rate limited.
+	tokens *tokenBucket
+
+	strictHost bool
+
+	cache *Cache
+}
+
+// apiState is what an MMSAPI learns from its responses, which is shared with
+// the copies made by WithContext.
+type apiState struct {
+	mutex      sync.Mutex
+	version    string
+	answeredBy string
+
+	deprecations     map[string]bool
+	deprecationOrder []string
+
+	redirectMismatches []string
+
+	// memo holds the body of every successful request for the rest of the
+	// run, keyed by path, unless memoization is disabled.
+	memo map[string][]byte
 }
 
 func NewMMSAPI(hostname string, timeout int, username string, apiKey string) (*MMSAPI, error) {
@@ -35,7 +115,7 @@ func NewMMSAPI(hostname string, timeout int, username string, apiKey string) (*M
 	// connection, and a response header timeout, but we have seen
 	// problems in the MongoDB MMS Backup Agent that required all three
 	// of these.
-	t.Transport = &http.Transport{
+	transport := &http.Transport{
 		Dial: func(network, addr string) (conn net.Conn, err error) {
 			conn, err = net.DialTimeout(network, addr, time.Duration(timeout)*time.Second)
 			if err != nil {
@@ -47,23 +127,244 @@ func NewMMSAPI(hostname string, timeout int, username string, apiKey string) (*M
 		},
 		DisableKeepAlives:     true,
 		ResponseHeaderTimeout: time.Duration(timeout) * time.Second,
+		Proxy:                 http.ProxyFromEnvironment,
+	}
+	t.Transport = transport
+
+	// Ask for JSON explicitly, as some gateways in front of Ops Manager
+	// answer the default */* with an HTML page.
+	headers := http.Header{}
+	headers.Set("Accept", "application/json")
+
+	state := &apiState{deprecations: map[string]bool{}, memo: map[string][]byte{}}
+	api := &MMSAPI{client: c, digest: t, transport: transport, hostname: hostname, headers: headers, ctx: context.Background(), apiState: state, retries: defaultRetries, timeout: time.Duration(timeout) * time.Second}
+	c.CheckRedirect = api.checkRedirect
+
+	return api, nil
+}
+
+// checkRedirect records redirects to a host other than the one the request
+// was made to, which may mean the connection was misdirected, and refuses
+// to follow them after SetStrictHost.
+func (api *MMSAPI) checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+
+	from := via[0].URL.Hostname()
+	to := request.URL.Hostname()
+	if strings.EqualFold(from, to) {
+		return nil
+	}
+
+	if api.strictHost {
+		return &RedirectError{From: from, To: to}
+	}
+
+	api.mutex.Lock()
+	api.redirectMismatches = append(api.redirectMismatches, fmt.Sprintf("%v redirected to %v", from, to))
+	api.mutex.Unlock()
+
+	return nil
+}
+
+// SetStrictHost refuses redirects to a host other than the one requested.
+func (api *MMSAPI) SetStrictHost() {
+	api.strictHost = true
+}
+
+// RedirectMismatches returns the redirects to another host that were
+// followed, as "from redirected to to".
+func (api *MMSAPI) RedirectMismatches() []string {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	return append([]string{}, api.redirectMismatches...)
+}
+
+// SetCAFile trusts the certificates of the PEM bundle at path instead of the
+// system roots, for servers with internally signed certificates.
+func (api *MMSAPI) SetCAFile(path string) error {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to read CA file. Error: %v", err))
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return errors.New(fmt.Sprintf("No PEM certificates found in CA file %v", path))
+	}
+
+	api.tlsConfig().RootCAs = roots
+	return nil
+}
+
+// SetInsecure skips the verification of the server's certificate.
+func (api *MMSAPI) SetInsecure() {
+	api.tlsConfig().InsecureSkipVerify = true
+}
+
+func (api *MMSAPI) tlsConfig() *tls.Config {
+	if api.transport.TLSClientConfig == nil {
+		api.transport.TLSClientConfig = &tls.Config{}
+	}
+
+	return api.transport.TLSClientConfig
+}
+
+// SetRealm sets the digest authentication realm, for servers whose challenge
+// names a different realm than the one the credentials are valid for.
+func (api *MMSAPI) SetRealm(realm string) {
+	api.digest.Realm = realm
+}
+
+// SetProxy sends every request through the proxy at proxyURL instead of the
+// one from the HTTP_PROXY and HTTPS_PROXY environment variables.
+func (api *MMSAPI) SetProxy(proxyURL string) error {
+	proxy, err := url.Parse(proxyURL)
+	if err != nil || proxy.Host == "" {
+		return errors.New(fmt.Sprintf("Invalid proxy URL %v", proxyURL))
 	}
 
-	return &MMSAPI{client: c, hostname: hostname}, nil
+	api.transport.Proxy = http.ProxyURL(proxy)
+	return nil
+}
+
+// DisableMemoization makes every request go to the server, for checks that
+// poll for a change within a single run.
+func (api *MMSAPI) DisableMemoization() {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	api.memo = nil
+}
+
+// KeepDuplicates stops metrics from being deduplicated by timestamp, for
+// comparing against what the server actually returned.
+func (api *MMSAPI) KeepDuplicates() {
+	api.keepDuplicates = true
 }
 
+// KeepExactValues keeps the exact values of integer counters beyond the
+// exact range of a float64, so that their changes are computed exactly.
+func (api *MMSAPI) KeepExactValues() {
+	api.keepExactValues = true
+}
+
+// SetRateLimit limits the requests made by every goroutine sharing the API
+// to perSecond, so that large checks do not trip the server's rate limits.
+func (api *MMSAPI) SetRateLimit(perSecond float64) {
+	if api.tokens != nil {
+		api.tokens.stop()
+	}
+	api.tokens = newTokenBucket(perSecond)
+}
+
+// Close releases what the API holds beyond its requests, such as the ticker
+// of the rate limit.
+func (api *MMSAPI) Close() {
+	if api.tokens != nil {
+		api.tokens.stop()
+	}
+}
+
+// WithContext returns a copy of the API whose requests are bounded by ctx.
+// The copy shares the connections, the memo and what was learned from the
+// responses with the original.
+func (api *MMSAPI) WithContext(ctx context.Context) *MMSAPI {
+	copied := *api
+	copied.ctx = ctx
+	return &copied
+}
+
+// Context returns the context that bounds the requests of the API.
+func (api *MMSAPI) Context() context.Context {
+	return api.ctx
+}
+
+// SetRetries sets how often a request that failed to connect or got a 5xx
+// response is retried. Zero disables retries.
+func (api *MMSAPI) SetRetries(retries int) {
+	api.retries = retries
+}
+
+// SetHeader sets a header sent with every request, replacing any previous
+// value, including the default Accept header.
+func (api *MMSAPI) SetHeader(name string, value string) {
+	api.headers.Set(name, value)
+}
+
+// GetAllHosts returns every host of the group, following the next links of
+// the paginated response until the last page.
 func (api *MMSAPI) GetAllHosts(groupId string) ([]model.Host, error) {
-	body, err := api.doGet(fmt.Sprintf("/groups/%v/hosts", groupId))
+	var hosts []model.Host
+	err := api.getAllPages(fmt.Sprintf("/groups/%v/hosts", groupId), func(body []byte) (string, error) {
+		hostResp := &model.HostsResponse{}
+		if err := unMarshalJSON(body, &hostResp); err != nil {
+			return "", err
+		}
+		hosts = append(hosts, hostResp.Hosts...)
+
+		return hostResp.Next(), nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	hostResp := &model.HostsResponse{}
-	if err := unMarshalJSON(body, &hostResp); err != nil {
-		return nil, err
+	return hosts, nil
+}
+
+// getAllPages requests path and then every page of the list that follows it,
+// passing each body to read, which returns the next link of the page.
+func (api *MMSAPI) getAllPages(path string, read func(body []byte) (string, error)) error {
+	seen := map[string]bool{}
+	for path != "" {
+		seen[path] = true
+
+		body, err := api.doGet(path)
+		if err != nil {
+			return err
+		}
+
+		next, err := read(body)
+		if err != nil {
+			return err
+		}
+
+		path = ""
+		if next != "" {
+			path, err = apiPath(next)
+			if err != nil {
+				return err
+			}
+			if seen[path] {
+				return errors.New(fmt.Sprintf("List links back to a page already read: %v", next))
+			}
+		}
+	}
+
+	return nil
+}
+
+// apiPath turns a link returned by the API into a path relative to the API
+// root, as taken by doGet.
+func apiPath(href string) (string, error) {
+	link, err := url.Parse(href)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Invalid link %v. Error: %v", href, err))
+	}
+
+	index := strings.Index(link.Path, "/api/public/v1.0/")
+	if index < 0 {
+		return "", errors.New(fmt.Sprintf("Link %v is not to the public API", href))
+	}
+
+	path := link.Path[index+len("/api/public/v1.0"):]
+	if link.RawQuery != "" {
+		path = fmt.Sprintf("%v?%v", path, link.RawQuery)
 	}
 
-	return hostResp.Hosts, nil
+	return path, nil
 }
 
 func (api *MMSAPI) GetHostByName(groupId string, name string) (*model.Host, error) {
@@ -80,8 +381,26 @@ func (api *MMSAPI) GetHostByName(groupId string, name string) (*model.Host, erro
 	return host, nil
 }
 
+func (api *MMSAPI) GetHost(groupId string, hostId string) (*model.Host, error) {
+	body, err := api.doGet(fmt.Sprintf("/groups/%v/hosts/%v", groupId, hostId))
+	if err != nil {
+		return nil, err
+	}
+
+	host := &model.Host{}
+	if err := unMarshalJSON(body, &host); err != nil {
+		return nil, err
+	}
+
+	return host, nil
+}
+
 func (api *MMSAPI) GetHostMetric(groupId string, hostId string, metricName string, granularity string, period string) (*model.Metric, error) {
-	body, err := api.doGet(fmt.Sprintf("/groups/%v/hosts/%v/metrics/%v?granularity=%v&period=PT%v", groupId, hostId, metricName, granularity, period))
+	return api.GetHostDBMetric(groupId, hostId, metricName, "", granularity, period)
+}
+
+func (api *MMSAPI) GetHostDBMetric(groupId string, hostId string, metricName string, dbName string, granularity string, period string) (*model.Metric, error) {
+	body, err := api.GetHostMetricBody(groupId, hostId, metricName, dbName, granularity, period)
 	if err != nil {
 		return nil, err
 	}
@@ -91,11 +410,37 @@ func (api *MMSAPI) GetHostMetric(groupId string, hostId string, metricName strin
 		return nil, err
 	}
 
+	if api.keepDuplicates == false {
+		metric.Dedupe()
+	}
+
+	if api.keepExactValues == false {
+		metric.RoundValues()
+	}
+
 	return metric, nil
 }
 
-func (api *MMSAPI) GetHostDBMetric(groupId string, hostId string, metricName string, dbName string, granularity string, period string) (*model.Metric, error) {
-	body, err := api.doGet(fmt.Sprintf("/groups/%v/hosts/%v/metrics/%v/%v?granularity=%v&period=PT%v", groupId, hostId, metricName, escape(dbName), granularity, period))
+// GetHostMetricBody returns the raw response body of a metric request without
+// parsing it. dbName may be empty for metrics that are not per database.
+func (api *MMSAPI) GetHostMetricBody(groupId string, hostId string, metricName string, dbName string, granularity string, period string) ([]byte, error) {
+	if dbName == "" {
+		return api.doGet(fmt.Sprintf("/groups/%v/hosts/%v/metrics/%v?granularity=%v&period=PT%v", groupId, hostId, metricName, granularity, period))
+	}
+
+	return api.doGet(fmt.Sprintf("/groups/%v/hosts/%v/metrics/%v/%v?granularity=%v&period=PT%v", groupId, hostId, metricName, escape(dbName), granularity, period))
+}
+
+// GetHostMetricRange fetches the data points of a metric between start and
+// end, rather than for a period ending now. dbName may be empty for metrics
+// that are not per database.
+func (api *MMSAPI) GetHostMetricRange(groupId string, hostId string, metricName string, dbName string, granularity string, start time.Time, end time.Time) (*model.Metric, error) {
+	path := fmt.Sprintf("/groups/%v/hosts/%v/metrics/%v", groupId, hostId, metricName)
+	if dbName != "" {
+		path = fmt.Sprintf("%v/%v", path, escape(dbName))
+	}
+
+	body, err := api.doGet(fmt.Sprintf("%v?granularity=%v&start=%v&end=%v", path, granularity, escape(start.UTC().Format(time.RFC3339)), escape(end.UTC().Format(time.RFC3339))))
 	if err != nil {
 		return nil, err
 	}
@@ -105,30 +450,454 @@ func (api *MMSAPI) GetHostDBMetric(groupId string, hostId string, metricName str
 		return nil, err
 	}
 
+	if api.keepDuplicates == false {
+		metric.Dedupe()
+	}
+
+	if api.keepExactValues == false {
+		metric.RoundValues()
+	}
+
 	return metric, nil
 }
 
+func (api *MMSAPI) GetHostMetrics(groupId string, hostId string) ([]model.MetricSummary, error) {
+	body, err := api.doGet(fmt.Sprintf("/groups/%v/hosts/%v/metrics", groupId, hostId))
+	if err != nil {
+		return nil, err
+	}
+
+	metricsResp := &model.MetricsResponse{}
+	if err := unMarshalJSON(body, &metricsResp); err != nil {
+		return nil, err
+	}
+
+	return metricsResp.Metrics, nil
+}
+
+func (api *MMSAPI) GetHostDatabases(groupId string, hostId string) ([]model.Database, error) {
+	body, err := api.doGet(fmt.Sprintf("/groups/%v/hosts/%v/databases", groupId, hostId))
+	if err != nil {
+		return nil, err
+	}
+
+	databasesResp := &model.DatabasesResponse{}
+	if err := unMarshalJSON(body, &databasesResp); err != nil {
+		return nil, err
+	}
+
+	return databasesResp.Databases, nil
+}
+
+func (api *MMSAPI) GetAgentLog(groupId string, hostId string, agentType string) ([]model.AgentLogEntry, error) {
+	body, err := api.doGet(fmt.Sprintf("/groups/%v/hosts/%v/logs/%v", groupId, hostId, agentType))
+	if err != nil {
+		return nil, err
+	}
+
+	logResp := &model.AgentLogResponse{}
+	if err := unMarshalJSON(body, &logResp); err != nil {
+		return nil, err
+	}
+
+	return logResp.Entries, nil
+}
+
+func (api *MMSAPI) GetAutomationConfig(groupId string) (*model.AutomationConfig, error) {
+	body, err := api.doGet(fmt.Sprintf("/groups/%v/automationConfig", groupId))
+	if err != nil {
+		return nil, err
+	}
+
+	config := &model.AutomationConfig{}
+	if err := unMarshalJSON(body, &config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// GetHostParameters returns the startup options a host is actually running
+// with, as nested maps in the layout of the automation config.
+func (api *MMSAPI) GetHostParameters(groupId string, hostId string) (map[string]interface{}, error) {
+	body, err := api.doGet(fmt.Sprintf("/groups/%v/hosts/%v/parameters", groupId, hostId))
+	if err != nil {
+		return nil, err
+	}
+
+	parameters := map[string]interface{}{}
+	if err := unMarshalJSON(body, &parameters); err != nil {
+		return nil, err
+	}
+
+	return parameters, nil
+}
+
+// GetOpenAlerts fetches the alerts of the group that are still open, from
+// every page of the list.
+func (api *MMSAPI) GetOpenAlerts(groupId string) ([]model.Alert, error) {
+	var alerts []model.Alert
+	err := api.getAllPages(fmt.Sprintf("/groups/%v/alerts?status=OPEN", groupId), func(body []byte) (string, error) {
+		alertsResp := &model.AlertsResponse{}
+		if err := unMarshalJSON(body, &alertsResp); err != nil {
+			return "", err
+		}
+		alerts = append(alerts, alertsResp.Alerts...)
+
+		return alertsResp.Next(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+// GetAlertConfigs returns the alert configs of the group, from every page of
+// the listing.
+func (api *MMSAPI) GetAlertConfigs(groupId string) (*model.AlertConfigsResponse, error) {
+	alertConfigs := &model.AlertConfigsResponse{}
+	err := api.getAllPages(fmt.Sprintf("/groups/%v/alertConfigs", groupId), func(body []byte) (string, error) {
+		alertConfigsResp := &model.AlertConfigsResponse{}
+		if err := unMarshalJSON(body, &alertConfigsResp); err != nil {
+			return "", err
+		}
+		alertConfigs.AlertConfigs = append(alertConfigs.AlertConfigs, alertConfigsResp.AlertConfigs...)
+
+		return alertConfigsResp.Next(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return alertConfigs, nil
+}
+
+func (api *MMSAPI) GetAutomationStatus(groupId string) (*model.AutomationStatus, error) {
+	body, err := api.doGet(fmt.Sprintf("/groups/%v/automationStatus", groupId))
+	if err != nil {
+		return nil, err
+	}
+
+	status := &model.AutomationStatus{}
+	if err := unMarshalJSON(body, &status); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// GetClusters fetches the replica sets and sharded clusters of the group.
+func (api *MMSAPI) GetClusters(groupId string) ([]model.Cluster, error) {
+	body, err := api.doGet(fmt.Sprintf("/groups/%v/clusters", groupId))
+	if err != nil {
+		return nil, err
+	}
+
+	clustersResp := &model.ClustersResponse{}
+	if err := unMarshalJSON(body, &clustersResp); err != nil {
+		return nil, err
+	}
+
+	return clustersResp.Clusters, nil
+}
+
+// GetShardChunks fetches the number of chunks held by each shard of a sharded
+// cluster. Versions without the endpoint respond with a 404, see IsNotFound.
+func (api *MMSAPI) GetShardChunks(groupId string, clusterId string) ([]model.ShardChunks, error) {
+	body, err := api.doGet(fmt.Sprintf("/groups/%v/clusters/%v/chunks", groupId, clusterId))
+	if err != nil {
+		return nil, err
+	}
+
+	chunksResp := &model.ShardChunksResponse{}
+	if err := unMarshalJSON(body, &chunksResp); err != nil {
+		return nil, err
+	}
+
+	return chunksResp.Shards, nil
+}
+
+// GetDeploymentHealth fetches the rolled-up health of the group's deployment.
+// Versions without the endpoint respond with a 404, see IsNotFound.
+func (api *MMSAPI) GetDeploymentHealth(groupId string) (*model.DeploymentHealth, error) {
+	body, err := api.doGet(fmt.Sprintf("/groups/%v/deployment/health", groupId))
+	if err != nil {
+		return nil, err
+	}
+
+	health := &model.DeploymentHealth{}
+	if err := unMarshalJSON(body, &health); err != nil {
+		return nil, err
+	}
+
+	return health, nil
+}
+
+// Ping makes a minimal request for the group and returns how long the API
+// took to respond.
+func (api *MMSAPI) Ping(groupId string) (time.Duration, error) {
+	start := time.Now()
+	if _, err := api.doGet(fmt.Sprintf("/groups/%v", groupId)); err != nil {
+		return 0, err
+	}
+
+	return time.Since(start), nil
+}
+
+// TestAuth makes a request that only needs valid credentials, listing the
+// groups the user can see.
+func (api *MMSAPI) TestAuth() error {
+	_, err := api.doGet("/groups")
+	return err
+}
+
+// SetFallback sets a second MMS/Ops Manager server that requests are retried
+// against when the primary server cannot be reached.
+func (api *MMSAPI) SetFallback(hostname string) {
+	api.fallback = hostname
+}
+
+// AnsweredBy returns the server that answered the most recent request, which
+// is the fallback server if the primary could not be reached.
+func (api *MMSAPI) AnsweredBy() string {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	return api.answeredBy
+}
+
+// PeerCertificate connects to the server and returns the leaf certificate it
+// presents, without verifying it or making a request, so that an expired or
+// untrusted certificate can still be inspected.
+func (api *MMSAPI) PeerCertificate() (*x509.Certificate, error) {
+	serverURL, err := url.Parse(api.hostname)
+	if err != nil || serverURL.Host == "" {
+		return nil, errors.New(fmt.Sprintf("Invalid server %v", api.hostname))
+	}
+	if serverURL.Scheme != "https" {
+		return nil, errors.New(fmt.Sprintf("%v does not use TLS", api.hostname))
+	}
+
+	address := serverURL.Host
+	if serverURL.Port() == "" {
+		address = net.JoinHostPort(serverURL.Hostname(), "443")
+	}
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: api.timeout},
+		Config:    &tls.Config{ServerName: serverURL.Hostname(), InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(api.ctx, "tcp", address)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to make a TLS connection to %v. Error: %v", address, err))
+	}
+	defer conn.Close()
+
+	certificates := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return nil, errors.New(fmt.Sprintf("%v did not present a TLS certificate", address))
+	}
+
+	return certificates[0], nil
+}
+
+// ServerVersion returns the MMS/Ops Manager version reported by the most
+// recent response, or an empty string if it has not been seen yet.
+func (api *MMSAPI) ServerVersion() string {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	return api.version
+}
+
 func (api *MMSAPI) doGet(path string) ([]byte, error) {
-	uri := fmt.Sprintf("%v/api/public/v1.0%v", api.hostname, path)
+	// Composite checks need the same data more than once, which only has
+	// to be fetched the first time.
+	api.mutex.Lock()
+	memoized, ok := api.memo[path]
+	api.mutex.Unlock()
+	if ok {
+		return memoized, nil
+	}
 
-	response, err := api.client.Get(uri)
+	// The timeouts of the transport only bound each phase of a connection,
+	// so the request, with its redirects, retries and the reading of the
+	// body, is bounded by the deadline of the run as well.
+	ctx := api.ctx
+	deadline, hasDeadline := ctx.Deadline()
+
+	if api.tokens != nil {
+		if err := api.tokens.wait(ctx); err != nil {
+			return nil, errors.New(fmt.Sprintf("Request for %v was not made within the timeout of %v because of the rate limit", path, api.timeout))
+		}
+	}
+
+	validators, keptBody := api.validators(path)
+
+	// Connection errors and 5xx responses are usually transient, e.g. during
+	// maintenance, so they are retried before giving up with the last error.
+	var response *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		var transient bool
+		response, transient, err = api.request(ctx, path, validators)
+		if err == nil && response.StatusCode < 500 {
+			break
+		}
+
+		backoff := retryBackoff << uint(attempt)
+		if (err != nil && !transient) || attempt >= api.retries || ctx.Err() != nil || (hasDeadline && time.Now().Add(backoff).After(deadline)) {
+			break
+		}
+
+		if err == nil {
+			response.Body.Close()
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, errors.New(fmt.Sprintf("Request for %v did not complete within the timeout of %v", path, api.timeout))
+	}
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Failed to make HTTP request. Error: %v", err))
+		return nil, err
 	}
 	defer response.Body.Close()
 
+	// The client follows redirects that carry a Location, so any redirect
+	// that reaches here had nowhere usable to go. A 304 is only expected in
+	// answer to a conditional request.
+	notModified := response.StatusCode == http.StatusNotModified && keptBody != nil
+	if response.StatusCode >= 300 && response.StatusCode < 400 && !notModified {
+		return nil, &APIError{StatusCode: response.StatusCode, Message: fmt.Sprintf("Unexpected redirect response from server (HTTP %v); check load balancer configuration", response.StatusCode)}
+	}
+
 	body, err := ioutil.ReadAll(response.Body)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, errors.New(fmt.Sprintf("Request for %v did not complete within the timeout of %v", path, api.timeout))
+	}
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Failed to read HTTP response body. Error: %v", err))
 	}
 
-	if response.StatusCode != 200 {
+	if serviceVersion := response.Header.Get("X-MongoDB-Service-Version"); serviceVersion != "" {
+		api.mutex.Lock()
+		api.version = serviceVersion
+		api.mutex.Unlock()
+	}
+
+	api.recordDeprecations(response.Header)
+
+	if notModified {
+		body = keptBody
+	} else if response.StatusCode == http.StatusUnauthorized && response.Header.Get("WWW-Authenticate") != "" {
+		// The challenge shows the realm and algorithm the server expects.
+		err := handleError(response.StatusCode, string(body[:])).(*APIError)
+		err.Message = fmt.Sprintf("%v. WWW-Authenticate: %v", err.Message, response.Header.Get("WWW-Authenticate"))
+		return nil, err
+	} else if response.StatusCode != 200 {
 		return nil, handleError(response.StatusCode, string(body[:]))
+	} else {
+		api.keepForRevalidation(path, response.Header, body)
 	}
 
+	api.mutex.Lock()
+	if api.memo != nil {
+		api.memo[path] = body
+	}
+	api.mutex.Unlock()
+
 	return body, nil
 }
 
+// request makes a single request for path, moving on to the fallback server
+// if the first cannot be reached. transient reports whether an error was a
+// failure to reach any server, which may succeed when retried.
+func (api *MMSAPI) request(ctx context.Context, path string, validators http.Header) (*http.Response, bool, error) {
+	servers := []string{api.hostname}
+	if api.fallback != "" {
+		servers = append(servers, api.fallback)
+	}
+
+	// Only a failure to reach a server moves on to the fallback. Any
+	// response, even an error, is the answer.
+	var err error
+	for _, server := range servers {
+		var response *http.Response
+		response, err = api.get(ctx, fmt.Sprintf("%v/api/public/v1.0%v", server, path), validators)
+		if err == nil {
+			api.mutex.Lock()
+			api.answeredBy = server
+			api.mutex.Unlock()
+			return response, false, nil
+		}
+
+		// Running out of time is not a failure of the server, and the
+		// fallback would not have any more of it.
+		if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+			return nil, false, err
+		}
+
+		var redirectErr *RedirectError
+		if errors.As(err, &redirectErr) {
+			return nil, false, redirectErr
+		}
+	}
+
+	return nil, true, errors.New(fmt.Sprintf("Failed to make HTTP request. Error: %v", err))
+}
+
+// recordDeprecations remembers the deprecation notices of a response, from
+// the standard Warning header or the Deprecation and Sunset headers.
+func (api *MMSAPI) recordDeprecations(header http.Header) {
+	var notices []string
+	notices = append(notices, header["Warning"]...)
+	if deprecation := header.Get("Deprecation"); deprecation != "" {
+		notices = append(notices, fmt.Sprintf("deprecated since %v", deprecation))
+	}
+	if sunset := header.Get("Sunset"); sunset != "" {
+		notices = append(notices, fmt.Sprintf("removed after %v", sunset))
+	}
+
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	for _, notice := range notices {
+		if !api.deprecations[notice] {
+			api.deprecations[notice] = true
+			api.deprecationOrder = append(api.deprecationOrder, notice)
+		}
+	}
+}
+
+// Deprecations returns the distinct deprecation notices seen in responses so
+// far, in the order they were first seen.
+func (api *MMSAPI) Deprecations() []string {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	return append([]string(nil), api.deprecationOrder...)
+}
+
+func (api *MMSAPI) get(ctx context.Context, uri string, extra http.Header) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range api.headers {
+		request.Header[name] = values
+	}
+	for name, values := range extra {
+		request.Header[name] = values
+	}
+
+	return api.client.Do(request)
+}
+
 func unMarshalJSON(payload []byte, outType interface{}) error {
 	if err := json.Unmarshal(payload, &outType); err != nil {
 		return errors.New(fmt.Sprintf("Response did not contain valid JSON. Error: %v, Body: %v", err, string(payload[:])))
@@ -137,13 +906,27 @@ func unMarshalJSON(payload []byte, outType interface{}) error {
 	return nil
 }
 
+// maxErrorBodyLength is how much of a body that is not an API error, such as
+// the HTML page of a load balancer, is kept in the error message.
+const maxErrorBodyLength = 200
+
+// handleError turns an error response into an APIError whose message always
+// has the status code, with the reason of an API error or otherwise the start
+// of the body on a single line.
 func handleError(statusCode int, body string) error {
 	var jsonBody map[string]interface{}
 	if err := json.Unmarshal([]byte(body), &jsonBody); err != nil {
-		return errors.New(fmt.Sprintf("API response did not contain valid JSON. Body: %v", body))
+		excerpt := []rune(strings.Join(strings.Fields(body), " "))
+		if len(excerpt) == 0 {
+			return &APIError{StatusCode: statusCode, Message: fmt.Sprintf("API Error (HTTP %v) with an empty response body", statusCode)}
+		}
+		if len(excerpt) > maxErrorBodyLength {
+			excerpt = append(excerpt[:maxErrorBodyLength], []rune("...")...)
+		}
+		return &APIError{StatusCode: statusCode, Message: fmt.Sprintf("API Error (HTTP %v): response did not contain valid JSON. Body: %v", statusCode, string(excerpt))}
 	}
 
-	return errors.New(fmt.Sprintf("API Error: %v (%v)", jsonBody["reason"], jsonBody["detail"]))
+	return &APIError{StatusCode: statusCode, Message: fmt.Sprintf("API Error (HTTP %v): %v (%v)", statusCode, jsonBody["reason"], jsonBody["detail"])}
 }
 
 func escape(piece string) string {
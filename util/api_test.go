@@ -0,0 +1,359 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestAPI returns an API for server whose requests are bounded by a
+// deadline of timeout seconds, as main sets up for a run.
+func newTestAPI(t *testing.T, server *httptest.Server, timeout int) *MMSAPI {
+	api, err := NewMMSAPI(server.URL, timeout, "user", "key")
+	if err != nil {
+		t.Fatalf("NewMMSAPI: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	t.Cleanup(cancel)
+	return api.WithContext(ctx)
+}
+
+func TestDoGetSlowServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		retries int
+		status  int
+	}{
+		{"no retries", 0, http.StatusOK},
+		{"retries", 2, http.StatusOK},
+		{"retries after 5xx", 5, http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The first response comes quickly, so that a server error is
+			// retried, and every later one only after the timeout.
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) > 1 || test.status == http.StatusOK {
+					select {
+					case <-time.After(5 * time.Second):
+					case <-r.Context().Done():
+						return
+					}
+				}
+				w.WriteHeader(test.status)
+				w.Write([]byte("{}"))
+			}))
+			defer server.Close()
+
+			api := newTestAPI(t, server, 1)
+			api.SetRetries(test.retries)
+
+			start := time.Now()
+			_, err := api.doGet("/groups/1")
+			elapsed := time.Since(start)
+
+			if err == nil || !strings.Contains(err.Error(), "did not complete within the timeout of 1s") {
+				t.Errorf("expected a timeout error, got %v", err)
+			}
+			if elapsed > 1500*time.Millisecond {
+				t.Errorf("request took %v, longer than the timeout of 1s", elapsed)
+			}
+		})
+	}
+}
+
+func TestDoGetSharedDeadline(t *testing.T) {
+	// Each request takes most of the timeout, so only the first of two
+	// can complete within the deadline of the run.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(700 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	api := newTestAPI(t, server, 1)
+	if _, err := api.doGet("/groups/1"); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if _, err := api.doGet("/groups/2"); err == nil {
+		t.Errorf("second request completed after the deadline of the run")
+	}
+}
+
+// newPagedServer serves the hosts of group g1 as pages of one host each,
+// where page i links to the page next[i], or to none if it is missing.
+func newPagedServer(hosts []string, next map[int]int) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/public/v1.0/groups/g1/hosts" {
+			http.NotFound(w, r)
+			return
+		}
+
+		page := 1
+		fmt.Sscanf(r.URL.Query().Get("pageNum"), "%d", &page)
+		links := "[]"
+		if to, ok := next[page]; ok {
+			links = fmt.Sprintf(`[{"rel": "next", "href": "%v/api/public/v1.0/groups/g1/hosts?pageNum=%v"}]`, server.URL, to)
+		}
+		fmt.Fprintf(w, `{"results": [{"id": "%v", "hostname": "%v", "port": 27017}], "links": %v}`, page, hosts[page-1], links)
+	}))
+
+	return server
+}
+
+func TestGetAllHostsPages(t *testing.T) {
+	tests := []struct {
+		name  string
+		hosts []string
+		next  map[int]int
+		want  []string
+		valid bool
+	}{
+		{"single page", []string{"db1"}, nil, []string{"db1"}, true},
+		{"two pages", []string{"db1", "db2"}, map[int]int{1: 2}, []string{"db1", "db2"}, true},
+		{"link back to the first page", []string{"db1", "db2"}, map[int]int{1: 2, 2: 1}, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newPagedServer(test.hosts, test.next)
+			defer server.Close()
+
+			hosts, err := newTestAPI(t, server, 5).GetAllHosts("g1")
+			if !test.valid {
+				if err == nil {
+					t.Errorf("expected an error, got %v hosts", len(hosts))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetAllHosts: %v", err)
+			}
+
+			if len(hosts) != len(test.want) {
+				t.Fatalf("got %v hosts, want %v", len(hosts), test.want)
+			}
+			for i, host := range hosts {
+				if host.Hostname != test.want[i] {
+					t.Errorf("host %v = %v, want %v", i, host.Hostname, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHandleError(t *testing.T) {
+	longPage := "<html><body>" + strings.Repeat("x", 300) + "</body></html>"
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"empty body", 502, "", "API Error (HTTP 502) with an empty response body"},
+		{"whitespace body", 503, " \n\t ", "API Error (HTTP 503) with an empty response body"},
+		{"API error", 404, `{"reason": "Not Found", "detail": "No host with ID 1"}`, "API Error (HTTP 404): Not Found (No host with ID 1)"},
+		{"HTML page", 502, "<html>\n  <body>\n    <h1>502 Bad Gateway</h1>\n  </body>\n</html>\n", "API Error (HTTP 502): response did not contain valid JSON. Body: <html> <body> <h1>502 Bad Gateway</h1> </body> </html>"},
+		{"long HTML page", 500, longPage, "API Error (HTTP 500): response did not contain valid JSON. Body: " + longPage[:maxErrorBodyLength] + "..."},
+	}
+
+	for _, test := range tests {
+		err := handleError(test.status, test.body)
+		apiErr, ok := err.(*APIError)
+		if ok == false {
+			t.Fatalf("%v: handleError returned %T, want *APIError", test.name, err)
+		}
+
+		if apiErr.StatusCode != test.status {
+			t.Errorf("%v: StatusCode = %v, want %v", test.name, apiErr.StatusCode, test.status)
+		}
+		if apiErr.Message != test.want {
+			t.Errorf("%v: Message = %q, want %q", test.name, apiErr.Message, test.want)
+		}
+	}
+}
+
+func TestRevalidatedPaths(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/groups/g1/hosts", true},
+		{"/groups/g1/hosts?pageNum=2", true},
+		{"/groups/g1/hosts/h1", false},
+		{"/groups/g1/hosts/h1/metrics/CONNECTIONS?granularity=MINUTE&period=PT1H", false},
+		{"/groups/g1/alerts?status=OPEN", false},
+		{"/groups", false},
+	}
+
+	for _, test := range tests {
+		if got := revalidatedPattern.MatchString(test.path); got != test.want {
+			t.Errorf("revalidated(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestPeerCertificateUntrusted(t *testing.T) {
+	// The test server's certificate is not trusted by the client, and the
+	// server answers every request with an error, neither of which may stop
+	// the certificate from being read.
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	certificate, err := newTestAPI(t, server, 5).PeerCertificate()
+	if err != nil {
+		t.Fatalf("PeerCertificate: %v", err)
+	}
+	if !certificate.NotAfter.Equal(server.Certificate().NotAfter) {
+		t.Errorf("NotAfter = %v, want %v", certificate.NotAfter, server.Certificate().NotAfter)
+	}
+}
+
+func TestPeerCertificatePlainHTTP(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	if _, err := newTestAPI(t, server, 5).PeerCertificate(); err == nil {
+		t.Errorf("PeerCertificate of a plain HTTP server did not fail")
+	}
+}
+
+func TestRequestDoesNotFallBackAfterTimeout(t *testing.T) {
+	var fallbackRequests int32
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fallbackRequests, 1)
+		w.Write([]byte("{}"))
+	}))
+	defer fallback.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	// The connection timeouts are longer than the deadline of the run, so
+	// it is the deadline that ends the request.
+	api := newTestAPI(t, slow, 5)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	api = api.WithContext(ctx)
+	api.SetFallback(fallback.URL)
+	if _, err := api.doGet("/groups/1"); err == nil {
+		t.Errorf("request to a server that timed out succeeded")
+	}
+	if requests := atomic.LoadInt32(&fallbackRequests); requests != 0 {
+		t.Errorf("fell back to the other server %v times after the timeout", requests)
+	}
+}
+
+func TestGetOpenAlertsPages(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/public/v1.0/groups/g1/alerts" || r.URL.Query().Get("status") != "OPEN" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.URL.Query().Get("pageNum") == "2" {
+			fmt.Fprint(w, `{"results": [{"id": "a2", "eventTypeName": "HOST_DOWN"}], "links": []}`)
+			return
+		}
+		fmt.Fprintf(w, `{"results": [{"id": "a1", "eventTypeName": "OPLOG_BEHIND"}], "links": [{"rel": "next", "href": "%v/api/public/v1.0/groups/g1/alerts?status=OPEN&pageNum=2"}]}`, server.URL)
+	}))
+	defer server.Close()
+
+	alerts, err := newTestAPI(t, server, 5).GetOpenAlerts("g1")
+	if err != nil {
+		t.Fatalf("GetOpenAlerts: %v", err)
+	}
+	if len(alerts) != 2 || alerts[0].Id != "a1" || alerts[1].Id != "a2" {
+		t.Errorf("alerts = %+v, want a1 and a2", alerts)
+	}
+}
+
+func TestStrictHostRefusesRedirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer target.Close()
+
+	// The same server by another name, which is a different host as far as
+	// the redirect is concerned.
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, fmt.Sprintf("http://localhost:%v%v", port, r.URL.Path), http.StatusFound)
+	}))
+	defer server.Close()
+
+	// As in main, the API is set up before it is given the deadline of the
+	// run, which copies it.
+	api, err := NewMMSAPI(server.URL, 5, "user", "key")
+	if err != nil {
+		t.Fatalf("NewMMSAPI: %v", err)
+	}
+	api.SetStrictHost()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = api.WithContext(ctx).doGet("/groups/1")
+
+	var redirectErr *RedirectError
+	if !errors.As(err, &redirectErr) {
+		t.Fatalf("expected a RedirectError, got %v", err)
+	}
+	if redirectErr.From != "127.0.0.1" || redirectErr.To != "localhost" {
+		t.Errorf("redirect from %v to %v, want from 127.0.0.1 to localhost", redirectErr.From, redirectErr.To)
+	}
+	if !strings.Contains(err.Error(), "127.0.0.1") || !strings.Contains(err.Error(), "localhost") {
+		t.Errorf("error %q does not name both hosts", err)
+	}
+}
+
+func TestGetAlertConfigsPages(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/public/v1.0/groups/g1/alertConfigs" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.URL.Query().Get("pageNum") == "2" {
+			fmt.Fprint(w, `{"results": [{"id": "c2", "enabled": true, "metricThreshold": {"metricName": "CONNECTIONS", "operator": "GREATER_THAN", "threshold": 1000, "units": "RAW"}}], "links": []}`)
+			return
+		}
+		fmt.Fprintf(w, `{"results": [{"id": "c1", "enabled": true, "metricThreshold": {"metricName": "MEMORY_RESIDENT", "operator": "GREATER_THAN", "threshold": 8, "units": "GIGABYTES"}}], "links": [{"rel": "next", "href": "%v/api/public/v1.0/groups/g1/alertConfigs?pageNum=2"}]}`, server.URL)
+	}))
+	defer server.Close()
+
+	alertConfigs, err := newTestAPI(t, server, 5).GetAlertConfigs("g1")
+	if err != nil {
+		t.Fatalf("GetAlertConfigs: %v", err)
+	}
+	if config := alertConfigs.MetricAlertConfig("CONNECTIONS"); config == nil || config.Id != "c2" {
+		t.Errorf("alert config of CONNECTIONS = %+v, want c2 from the second page", config)
+	}
+}
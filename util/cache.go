@@ -0,0 +1,115 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Cache is a small on-disk key/value store used to remember expensive
+// lookups between plugin invocations. Caching is best effort: a missing or
+// corrupt cache file simply results in an empty cache.
+type Cache struct {
+	path    string
+	mutex   sync.Mutex
+	Entries map[string]CacheEntry `json:"entries"`
+}
+
+type CacheEntry struct {
+	Value   json.RawMessage `json:"value"`
+	Expires time.Time       `json:"expires"`
+}
+
+func LoadCache(path string) *Cache {
+	cache := &Cache{path: path, Entries: map[string]CacheEntry{}}
+	if path == "" {
+		return cache
+	}
+
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+
+	if err := json.Unmarshal(body, cache); err != nil || cache.Entries == nil {
+		cache.Entries = map[string]CacheEntry{}
+	}
+
+	return cache
+}
+
+// Get decodes the unexpired value stored under key into out, returning
+// false if there is no such value.
+func (cache *Cache) Get(key string, out interface{}) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, ok := cache.Entries[key]
+	if ok == false || time.Now().After(entry.Expires) {
+		return false
+	}
+
+	return json.Unmarshal(entry.Value, out) == nil
+}
+
+func (cache *Cache) Set(key string, value interface{}, ttl time.Duration) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to encode cache value. Error: %v", err))
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.Entries[key] = CacheEntry{Value: body, Expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (cache *Cache) Delete(key string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	delete(cache.Entries, key)
+}
+
+// Save writes the unexpired entries back to disk, replacing the cache file
+// atomically so that concurrent plugin runs never read a partial file.
+func (cache *Cache) Save() error {
+	if cache.path == "" {
+		return nil
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for key, entry := range cache.Entries {
+		if time.Now().After(entry.Expires) {
+			delete(cache.Entries, key)
+		}
+	}
+
+	body, err := json.Marshal(cache)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to encode cache. Error: %v", err))
+	}
+
+	tmpPath := fmt.Sprintf("%v.%v", cache.path, os.Getpid())
+	if err := ioutil.WriteFile(tmpPath, body, 0600); err != nil {
+		return errors.New(fmt.Sprintf("Failed to write cache file. Error: %v", err))
+	}
+
+	if err := os.Rename(tmpPath, cache.path); err != nil {
+		os.Remove(tmpPath)
+		return errors.New(fmt.Sprintf("Failed to write cache file. Error: %v", err))
+	}
+
+	return nil
+}
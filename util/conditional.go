@@ -0,0 +1,68 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// How long a response is kept for revalidation with a conditional request.
+const conditionalTTL = 24 * time.Hour
+
+// revalidatedPattern matches the paths of the host listings, the pages of
+// which are the only responses large and unchanging enough to be worth
+// keeping for revalidation. Metrics change with every sample.
+var revalidatedPattern = regexp.MustCompile(`^/groups/[^/?]+/hosts(\?.*)?$`)
+
+// conditionalResponse is a response body kept with the validators the server
+// sent for it, so that the next run can ask whether it has changed.
+type conditionalResponse struct {
+	ETag         string `json:"etag"`
+	LastModified string `json:"lastModified"`
+	Body         []byte `json:"body"`
+}
+
+func (api *MMSAPI) conditionalKey(path string) string {
+	return fmt.Sprintf("conditional/%v%v", api.hostname, path)
+}
+
+// validators returns the conditional request headers for path, and the body
+// they validate, or no headers if no earlier response was kept.
+func (api *MMSAPI) validators(path string) (http.Header, []byte) {
+	headers := http.Header{}
+	var kept conditionalResponse
+	if api.cache == nil || !revalidatedPattern.MatchString(path) || api.cache.Get(api.conditionalKey(path), &kept) == false {
+		return headers, nil
+	}
+
+	if kept.ETag != "" {
+		headers.Set("If-None-Match", kept.ETag)
+	}
+	if kept.LastModified != "" {
+		headers.Set("If-Modified-Since", kept.LastModified)
+	}
+
+	return headers, kept.Body
+}
+
+// keepForRevalidation keeps the body of a host listing if the server sent
+// validators with it. The cache is saved once at the end of the run.
+func (api *MMSAPI) keepForRevalidation(path string, header http.Header, body []byte) {
+	kept := conditionalResponse{ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified"), Body: body}
+	if api.cache == nil || !revalidatedPattern.MatchString(path) || (kept.ETag == "" && kept.LastModified == "") {
+		return
+	}
+
+	api.cache.Set(api.conditionalKey(path), kept, conditionalTTL)
+}
+
+// SetCache keeps host listings that carry an ETag or Last-Modified header in
+// cache, so that later runs only fetch them again if they have changed.
+func (api *MMSAPI) SetCache(cache *Cache) {
+	api.cache = cache
+}
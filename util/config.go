@@ -0,0 +1,89 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config is the connection profile read from a credentials file of
+// "key = value" lines. Blank lines and lines starting with # are ignored.
+type Config struct {
+	Path   string
+	values map[string]string
+}
+
+func LoadConfig(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// The file holds an API key, so it must not be readable by anyone else.
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %v. Error: %v", path, err))
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, errors.New(fmt.Sprintf("%v is readable by other users (mode %v). Restrict it with chmod 600", path, info.Mode().Perm()))
+	}
+
+	config := &Config{Path: path, values: map[string]string{}}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New(fmt.Sprintf("Invalid line %v in %v. Expected key = value", lineNumber, path))
+		}
+		config.values[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %v. Error: %v", path, err))
+	}
+
+	return config, nil
+}
+
+// LoadConfigFromHome loads the named credentials file from the home directory.
+func LoadConfigFromHome(name string) (*Config, error) {
+	return LoadConfig(filepath.Join(os.Getenv("HOME"), name))
+}
+
+// FindConfig loads the named credentials file from the home directory, or
+// from the working directory if there is none in the home directory.
+func FindConfig(name string) (*Config, error) {
+	config, err := LoadConfigFromHome(name)
+	if os.IsNotExist(err) {
+		return LoadConfig(name)
+	}
+
+	return config, err
+}
+
+// Get returns the value of key, or an empty string if it is not set.
+func (config *Config) Get(key string) string {
+	return config.values[key]
+}
+
+func (config *Config) GetCredentials() (string, string) {
+	return config.Get("username"), config.Get("apikey")
+}
+
+// Server returns the MMS/Ops Manager server of the profile, if it has one.
+func (config *Config) Server() string {
+	return config.Get("server")
+}
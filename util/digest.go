@@ -65,6 +65,9 @@ type Transport struct {
 	Username  string
 	Password  string
 	Transport http.RoundTripper
+
+	// Realm, if set, is used instead of the realm of the server's challenge.
+	Realm string
 }
 
 // NewTransport creates a new digest transport using the http.DefaultTransport.
@@ -210,9 +213,14 @@ func (c *credentials) authorize() (string, error) {
 }
 
 func (t *Transport) newCredentials(req *http.Request, c *challenge) *credentials {
+	realm := c.Realm
+	if t.Realm != "" {
+		realm = t.Realm
+	}
+
 	return &credentials{
 		Username:   t.Username,
-		Realm:      c.Realm,
+		Realm:      realm,
 		Nonce:      c.Nonce,
 		DigestURI:  req.URL.RequestURI(),
 		Algorithm:  c.Algorithm,
@@ -0,0 +1,38 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Headers maps HTTP header names to the value sent with every API request.
+// It implements flag.Value so that it can be filled from a repeatable
+// "Name: value" flag.
+type Headers map[string]string
+
+func (headers Headers) String() string {
+	var pairs []string
+	for name, value := range headers {
+		pairs = append(pairs, fmt.Sprintf("%v: %v", name, value))
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func (headers Headers) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return errors.New(fmt.Sprintf("Invalid header %v. Expected Name: value", value))
+	}
+
+	headers[http.CanonicalHeaderKey(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+	return nil
+}
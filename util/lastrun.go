@@ -0,0 +1,57 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"../model"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// How long the value seen by a run is kept for the next one.
+const lastRunTTL = 30 * 24 * time.Hour
+
+type lastRunValue struct {
+	Timestamp time.Time   `json:"timestamp"`
+	Value     json.Number `json:"value"`
+}
+
+// RateSinceLastRun returns the per second rate at which a counter went up
+// between the data point the previous run stored under key and dataPoint, and
+// stores dataPoint for the next run. ok is false on the first run, and when
+// there is no newer data point than on the previous run. A counter that went
+// down was reset, so its whole current value is counted as the increase.
+func RateSinceLastRun(cache *Cache, key string, dataPoint model.DataPoint) (rate float64, elapsed time.Duration, ok bool, err error) {
+	var last lastRunValue
+	found := cache.Get(key, &last)
+	if found && !dataPoint.Timestamp.After(last.Timestamp) {
+		return 0, 0, false, nil
+	}
+
+	number := dataPoint.Number
+	if number == "" {
+		number = json.Number(strconv.FormatFloat(dataPoint.Value, 'f', -1, 64))
+	}
+
+	cache.Set(key, lastRunValue{Timestamp: dataPoint.Timestamp, Value: number}, lastRunTTL)
+	if err := cache.Save(); err != nil {
+		return 0, 0, false, err
+	}
+
+	if found == false {
+		return 0, 0, false, nil
+	}
+
+	value, _ := last.Value.Float64()
+	previous := model.DataPoint{Timestamp: last.Timestamp, Value: value, Number: last.Value}
+	increase := dataPoint.Sub(previous)
+	if increase < 0 {
+		increase = dataPoint.Value
+	}
+
+	elapsed = dataPoint.Timestamp.Sub(last.Timestamp)
+	return increase / elapsed.Seconds(), elapsed, true, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// MetricMap is a set of named check bundles, loaded from a JSON file such as:
+//
+//	{
+//	  "bundles": {
+//	    "mongod": [
+//	      {"metric": "CONNECTIONS", "warning": "700", "critical": "900"},
+//	      {"metric": "MEMORY_RESIDENT", "thresholds": "warn:8G,crit:10G"}
+//	    ]
+//	  }
+//	}
+type MetricMap struct {
+	Bundles map[string][]BundleMetric `json:"bundles"`
+}
+
+// BundleMetric is one metric of a bundle. Empty fields fall back to the
+// values given on the command line.
+type BundleMetric struct {
+	Metric          string `json:"metric"`
+	DBName          string `json:"dbname"`
+	Warning         string `json:"warning"`
+	Critical        string `json:"critical"`
+	Thresholds      string `json:"thresholds"`
+	HostAggregation string `json:"hostAggregation"`
+}
+
+func LoadMetricMap(path string) (*MetricMap, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read metric map. Error: %v", err))
+	}
+
+	metricMap := &MetricMap{}
+	if err := json.Unmarshal(body, metricMap); err != nil {
+		return nil, errors.New(fmt.Sprintf("Metric map %v did not contain valid JSON. Error: %v", path, err))
+	}
+
+	return metricMap, nil
+}
+
+func (metricMap *MetricMap) Bundle(name string) ([]BundleMetric, error) {
+	bundle, ok := metricMap.Bundles[name]
+	if ok == false || len(bundle) == 0 {
+		return nil, errors.New(fmt.Sprintf("Bundle %v not found in the metric map", name))
+	}
+
+	for i, metric := range bundle {
+		if metric.Metric == "" {
+			return nil, errors.New(fmt.Sprintf("Metric %v of bundle %v has no metric name", i+1, name))
+		}
+	}
+
+	return bundle, nil
+}
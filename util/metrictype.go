@@ -0,0 +1,65 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"../model"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	MetricTypeGauge   = "GAUGE"
+	MetricTypeCounter = "COUNTER"
+)
+
+const metricTypeTTL = 7 * 24 * time.Hour
+
+// ClassifyMetric returns whether a metric is a counter or a gauge. Counters
+// are the metrics counted since the process started, unless the server lists
+// the metric in per second units, as it does for opcounters and network
+// traffic. One lookup of the host's metrics classifies all of them, and the
+// result is cached per Ops Manager version so that repeated runs do not look
+// them up again.
+func ClassifyMetric(api *MMSAPI, cache *Cache, groupId string, hostId string, metricName string) (string, error) {
+	key := metricTypeKey(api.ServerVersion(), metricName)
+
+	var metricType string
+	if cache.Get(key, &metricType) {
+		return metricType, nil
+	}
+
+	summaries, err := api.GetHostMetrics(groupId, hostId)
+	if err != nil {
+		return "", err
+	}
+
+	metricType = classifyUnits(metricName, "")
+	for _, summary := range summaries {
+		summaryType := classifyUnits(summary.MetricName, summary.Units)
+		cache.Set(metricTypeKey(api.ServerVersion(), summary.MetricName), summaryType, metricTypeTTL)
+		if summary.MetricName == metricName {
+			metricType = summaryType
+		}
+	}
+	cache.Set(key, metricType, metricTypeTTL)
+
+	return metricType, nil
+}
+
+func metricTypeKey(version string, metricName string) string {
+	return fmt.Sprintf("metricType/%v/%v", version, metricName)
+}
+
+// classifyUnits classifies a metric the server lists in units, which are empty
+// for a metric it does not list.
+func classifyUnits(metricName string, units string) string {
+	if strings.HasSuffix(units, "_PER_SECOND") || !model.IsCumulative(metricName) {
+		return MetricTypeGauge
+	}
+
+	return MetricTypeCounter
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClassifyUnits(t *testing.T) {
+	tests := []struct {
+		metricName string
+		units      string
+		want       string
+	}{
+		{"ASSERT_REGULAR", "", MetricTypeCounter},
+		{"ASSERT_USER", "RAW", MetricTypeCounter},
+		{"CURSORS_TOTAL_TIMED_OUT", "", MetricTypeCounter},
+
+		// Rates, which are described per second.
+		{"OPCOUNTERS_INSERT", "", MetricTypeGauge},
+		{"OPCOUNTERS_REPL_UPDATE", "", MetricTypeGauge},
+		{"NETWORK_BYTES_IN", "", MetricTypeGauge},
+		{"NETWORK_NUM_REQUESTS", "", MetricTypeGauge},
+		{"EXTRA_INFO_PAGE_FAULTS", "", MetricTypeGauge},
+
+		// A counter the server reports as a rate.
+		{"ASSERT_REGULAR", "SCALAR_PER_SECOND", MetricTypeGauge},
+
+		// Gauges that only grow in practice are still gauges.
+		{"DB_DATA_SIZE_TOTAL", "BYTES", MetricTypeGauge},
+		{"CONNECTIONS", "", MetricTypeGauge},
+		{"UNKNOWN_METRIC", "", MetricTypeGauge},
+	}
+
+	for _, test := range tests {
+		if got := classifyUnits(test.metricName, test.units); got != test.want {
+			t.Errorf("classifyUnits(%q, %q) = %v, want %v", test.metricName, test.units, got, test.want)
+		}
+	}
+}
+
+func TestClassifyMetricCached(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("X-MongoDB-Service-Version", "gitHash=abc; versionString=4.4.0")
+		w.Write([]byte(`{"results": [{"metricName": "ASSERT_REGULAR", "units": "RAW"}, {"metricName": "ASSERT_USER", "units": "SCALAR_PER_SECOND"}]}`))
+	}))
+	defer server.Close()
+
+	cache := LoadCache("")
+
+	tests := []struct {
+		metricName string
+		want       string
+	}{
+		{"ASSERT_REGULAR", MetricTypeCounter},
+		{"ASSERT_USER", MetricTypeGauge},
+		{"CURSORS_TOTAL_TIMED_OUT", MetricTypeCounter},
+	}
+
+	for run := 0; run < 2; run++ {
+		// Each run starts with a request that tells the server version the
+		// classification is kept for, as fetching the metric does.
+		api := newTestAPI(t, server, 5)
+		api.Ping("g1")
+
+		for _, test := range tests {
+			got, err := ClassifyMetric(api, cache, "g1", "h1", test.metricName)
+			if err != nil {
+				t.Fatalf("ClassifyMetric(%q): %v", test.metricName, err)
+			}
+			if got != test.want {
+				t.Errorf("ClassifyMetric(%q) = %v, want %v", test.metricName, got, test.want)
+			}
+		}
+	}
+
+	// Two pings and a single lookup of the host's metrics, as the second run
+	// finds every metric in the cache.
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Errorf("made %v requests, want 3", got)
+	}
+
+	var cached string
+	if !cache.Get("metricType/gitHash=abc; versionString=4.4.0/ASSERT_REGULAR", &cached) || cached != MetricTypeCounter {
+		t.Errorf("ASSERT_REGULAR is not cached for the server version, got %q", cached)
+	}
+}
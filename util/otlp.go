@@ -0,0 +1,135 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The OTLP/JSON encoding of an export request, as far as it is needed to
+// send gauges and counters.
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpAttribute struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   map[string]string `json:"scope"`
+	Metrics []otlpMetric      `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Unit  string     `json:"unit,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+// otlpSum is a cumulative, monotonic sum, as nagios counters are.
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	TimeUnixNano string  `json:"timeUnixNano"`
+	AsDouble     float64 `json:"asDouble"`
+}
+
+const otlpCumulative = 2
+
+// OTLP renders the perfdata and series of the report as an OTLP/JSON metrics
+// export request, with attributes identifying where they came from. Perfdata
+// with the 'c' unit are sent as counters, everything else as gauges.
+func (report *Report) OTLP(attributes map[string]string) ([]byte, error) {
+	var keys []string
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	resource := otlpResource{Attributes: []otlpAttribute{{Key: "service.name", Value: map[string]string{"stringValue": "check_mongodb_mms"}}}}
+	for _, key := range keys {
+		resource.Attributes = append(resource.Attributes, otlpAttribute{Key: key, Value: map[string]string{"stringValue": attributes[key]}})
+	}
+
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	var metrics []otlpMetric
+	for _, datum := range report.PerfData {
+		dataPoints := []otlpDataPoint{{TimeUnixNano: now, AsDouble: datum.Value}}
+		if datum.Unit == "c" {
+			metrics = append(metrics, otlpMetric{Name: datum.Label, Sum: &otlpSum{DataPoints: dataPoints, AggregationTemporality: otlpCumulative, IsMonotonic: true}})
+		} else {
+			metrics = append(metrics, otlpMetric{Name: datum.Label, Unit: datum.Unit, Gauge: &otlpGauge{DataPoints: dataPoints}})
+		}
+	}
+
+	for _, series := range report.Series {
+		var dataPoints []otlpDataPoint
+		for _, dataPoint := range series.DataPoints {
+			if dataPoint.Null {
+				continue
+			}
+			dataPoints = append(dataPoints, otlpDataPoint{TimeUnixNano: strconv.FormatInt(dataPoint.Timestamp.UnixNano(), 10), AsDouble: dataPoint.Value})
+		}
+		metrics = append(metrics, otlpMetric{Name: series.Label, Gauge: &otlpGauge{DataPoints: dataPoints}})
+	}
+
+	request := otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     resource,
+		ScopeMetrics: []otlpScopeMetrics{{Scope: map[string]string{"name": "check_mongodb_mms"}, Metrics: metrics}},
+	}}}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to encode OTLP metrics. Error: %v", err))
+	}
+
+	return body, nil
+}
+
+// PushOTLP posts an OTLP/JSON export request to the metrics endpoint of an
+// OTLP/HTTP receiver, giving up after timeout.
+func PushOTLP(endpoint string, body []byte, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	response, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to export OTLP metrics. Error: %v", err))
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(response.Body)
+		return errors.New(fmt.Sprintf("OTLP endpoint %v rejected the metrics with HTTP %v: %v", endpoint, response.StatusCode, string(message)))
+	}
+
+	return nil
+}
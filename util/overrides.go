@@ -0,0 +1,47 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UnitOverrides maps metric names to the nagios perfdata unit that should be
+// reported for them. It implements flag.Value so that it can be filled from
+// a repeatable METRIC=UOM flag.
+type UnitOverrides map[string]string
+
+func (overrides UnitOverrides) String() string {
+	var pairs []string
+	for metric, unit := range overrides {
+		pairs = append(pairs, fmt.Sprintf("%v=%v", metric, unit))
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func (overrides UnitOverrides) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.New(fmt.Sprintf("Invalid unit override %v. Expected METRIC=UOM", value))
+	}
+
+	if !IsValidPerfUnit(parts[1]) {
+		return errors.New(fmt.Sprintf("Invalid unit override %v. Acceptable units are s us ms %% B KB MB GB TB c, or empty", value))
+	}
+
+	overrides[parts[0]] = parts[1]
+	return nil
+}
+
+// IsValidPerfUnit reports whether unit is a unit of measurement allowed in
+// nagios perfdata.
+func IsValidPerfUnit(unit string) bool {
+	return validPerfUnits[unit]
+}
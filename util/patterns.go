@@ -0,0 +1,46 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Patterns is a list of regular expressions. It implements flag.Value so
+// that it can be filled from a repeatable flag.
+type Patterns []*regexp.Regexp
+
+func (patterns *Patterns) String() string {
+	var exprs []string
+	for _, pattern := range *patterns {
+		exprs = append(exprs, pattern.String())
+	}
+
+	return strings.Join(exprs, ",")
+}
+
+func (patterns *Patterns) Set(value string) error {
+	pattern, err := regexp.Compile(value)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Invalid pattern %v. Error: %v", value, err))
+	}
+
+	*patterns = append(*patterns, pattern)
+	return nil
+}
+
+// MatchAny reports whether any of the patterns matches s.
+func (patterns *Patterns) MatchAny(s string) bool {
+	for _, pattern := range *patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+
+	return false
+}
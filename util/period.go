@@ -0,0 +1,65 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Ops Manager only keeps minute data for 48 hours and hourly data for 63
+// days, so longer periods have to be queried at a coarser granularity.
+const (
+	maxMinuteGranularityPeriod = 48 * time.Hour
+	maxHourGranularityPeriod   = 63 * 24 * time.Hour
+)
+
+var periodPattern = regexp.MustCompile(`^(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?$`)
+
+// ParsePeriod converts the time portion of an ISO-8601 duration, as passed to
+// the -p flag without its PT prefix (e.g. 1H, 30M, 1H30M), into a
+// time.Duration.
+func ParsePeriod(period string) (time.Duration, error) {
+	matches := periodPattern.FindStringSubmatch(period)
+	if period == "" || matches == nil {
+		return 0, errors.New(fmt.Sprintf("Invalid period %v. Expected a value such as 1H, 30M or 1H30M", period))
+	}
+
+	var duration time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		if matches[i+1] == "" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(matches[i+1], 64)
+		if err != nil {
+			return 0, errors.New(fmt.Sprintf("Invalid period %v. Error: %v", period, err))
+		}
+		duration += time.Duration(value * float64(unit))
+	}
+
+	return duration, nil
+}
+
+// AutoGranularity picks the finest granularity that keeps the number of
+// data points returned for period reasonable.
+func AutoGranularity(period string) (string, error) {
+	duration, err := ParsePeriod(period)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case duration <= maxMinuteGranularityPeriod:
+		return "MINUTE", nil
+	case duration <= maxHourGranularityPeriod:
+		return "HOUR", nil
+	default:
+		return "DAY", nil
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"testing"
+)
+
+func TestAutoGranularity(t *testing.T) {
+	tests := []struct {
+		period string
+		want   string
+	}{
+		{"1H", "MINUTE"},
+		{"48H", "MINUTE"},
+		{"49H", "HOUR"},
+		{"1512H", "HOUR"},
+		{"1513H", "DAY"},
+	}
+
+	for _, test := range tests {
+		got, err := AutoGranularity(test.period)
+		if err != nil || got != test.want {
+			t.Errorf("AutoGranularity(%q) = %v, %v, want %v", test.period, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The range of rate limits accepted, and the most tokens a bucket keeps. The
+// bounds keep the ticker interval valid and the bucket small.
+const (
+	minRateLimit = 0.01
+	maxRateLimit = 1000
+	maxBurst     = 100
+)
+
+// ParseRateLimit parses a --rate-limit value such as 10/sec, 10/s or 10 into
+// a number of requests per second.
+func ParseRateLimit(value string) (float64, error) {
+	number := value
+	if i := strings.Index(value, "/"); i >= 0 {
+		switch value[i+1:] {
+		case "s", "sec", "second":
+		default:
+			return 0, errors.New(fmt.Sprintf("Invalid rate limit %v. Expected a number of requests per second such as 10/sec", value))
+		}
+		number = value[:i]
+	}
+
+	rate, err := strconv.ParseFloat(number, 64)
+	if err != nil || rate <= 0 {
+		return 0, errors.New(fmt.Sprintf("Invalid rate limit %v. Expected a number of requests per second such as 10/sec", value))
+	}
+
+	// This also rejects NaN and infinity.
+	if !(rate >= minRateLimit && rate <= maxRateLimit) {
+		return 0, errors.New(fmt.Sprintf("Invalid rate limit %v. Expected between %v and %v requests per second", value, minRateLimit, maxRateLimit))
+	}
+
+	return rate, nil
+}
+
+// tokenBucket holds the tokens a ticker adds perSecond times a second, one of
+// which every request takes.
+type tokenBucket struct {
+	tokens chan bool
+	ticker *time.Ticker
+	done   chan bool
+}
+
+// newTokenBucket returns a bucket filled perSecond times a second. Up to a
+// second's worth of tokens, at most maxBurst, are kept, so a burst after a
+// quiet spell is allowed but the average rate is not exceeded.
+func newTokenBucket(perSecond float64) *tokenBucket {
+	burst := int(perSecond)
+	if burst < 1 {
+		burst = 1
+	}
+	if burst > maxBurst {
+		burst = maxBurst
+	}
+
+	bucket := &tokenBucket{tokens: make(chan bool, burst), ticker: time.NewTicker(time.Duration(float64(time.Second) / perSecond)), done: make(chan bool)}
+	bucket.tokens <- true
+
+	go func() {
+		for {
+			select {
+			case <-bucket.ticker.C:
+				select {
+				case bucket.tokens <- true:
+				default:
+				}
+			case <-bucket.done:
+				return
+			}
+		}
+	}()
+
+	return bucket
+}
+
+// wait takes a token, waiting for one unless ctx is done first.
+func (bucket *tokenBucket) wait(ctx context.Context) error {
+	select {
+	case <-bucket.tokens:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop stops filling the bucket.
+func (bucket *tokenBucket) stop() {
+	bucket.ticker.Stop()
+	close(bucket.done)
+}
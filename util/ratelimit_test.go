@@ -0,0 +1,57 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		valid bool
+	}{
+		{"10", 10, true},
+		{"10/s", 10, true},
+		{"0.5/sec", 0.5, true},
+		{"1000/second", 1000, true},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"1001", 0, false},
+		{"1e18", 0, false},
+		{"0.000000001", 0, false},
+		{"NaN", 0, false},
+		{"Inf", 0, false},
+		{"10/min", 0, false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseRateLimit(test.value)
+		if test.valid && (err != nil || got != test.want) {
+			t.Errorf("ParseRateLimit(%q) = %v, %v, want %v", test.value, got, err, test.want)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("ParseRateLimit(%q) = %v, want an error", test.value, got)
+		}
+	}
+}
+
+func TestTokenBucketWaitCancelled(t *testing.T) {
+	bucket := newTokenBucket(minRateLimit)
+	defer bucket.stop()
+
+	if err := bucket.wait(context.Background()); err != nil {
+		t.Fatalf("first token: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := bucket.wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("wait = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,523 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"../model"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fractalcat/nagiosplugin"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var unsafeLabelPattern = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// perfUnits maps the units of the API to nagios perfdata units and the factor
+// that converts values to them. Sizes are all reported in bytes and durations
+// in seconds or milliseconds, the largest units nagios knows.
+var perfUnits = map[string]struct {
+	unit   string
+	factor float64
+}{
+	"BYTES":        {"B", unitBytes["BYTES"]},
+	"KILOBYTES":    {"B", unitBytes["KILOBYTES"]},
+	"MEGABYTES":    {"B", unitBytes["MEGABYTES"]},
+	"GIGABYTES":    {"B", unitBytes["GIGABYTES"]},
+	"TERABYTES":    {"B", unitBytes["TERABYTES"]},
+	"PETABYTES":    {"B", unitBytes["PETABYTES"]},
+	"MILLISECONDS": {"ms", 1},
+	"SECONDS":      {"s", 1},
+	"MINUTES":      {"s", 60},
+	"HOURS":        {"s", 60 * 60},
+	"DAYS":         {"s", 24 * 60 * 60},
+	"PERCENT":      {"%", 1},
+}
+
+// PerfUnit returns the perfdata unit for a metric measured in units, and the
+// factor that converts its values to that unit. Units nagios has no unit for
+// are reported as plain numbers.
+func PerfUnit(units string) (string, float64) {
+	perfUnit, ok := perfUnits[units]
+	if ok == false {
+		return "", 1
+	}
+
+	return perfUnit.unit, perfUnit.factor
+}
+
+var validPerfUnits = map[string]bool{
+	"":   true,
+	"s":  true,
+	"us": true,
+	"ms": true,
+	"%":  true,
+	"B":  true,
+	"KB": true,
+	"MB": true,
+	"GB": true,
+	"TB": true,
+	"c":  true,
+}
+
+// Report collects the results and performance data of a check. It mirrors
+// the nagiosplugin.Check API so that checks can be written the same way,
+// while leaving the choice of output format until the check has finished.
+type Report struct {
+	Status   nagiosplugin.Status
+	Results  []ReportResult
+	PerfData []PerfDatum
+	Series   []Series
+	Groups   []ReportGroup
+
+	// Observation is the value a single target check compared with its
+	// thresholds, for the JSON output. It is nil for other checks.
+	Observation *Observation
+}
+
+// Observation is the value a check compared with its thresholds, how old it
+// was, and the thresholds themselves, either a warning and critical range or
+// stepped thresholds.
+type Observation struct {
+	Metric     string
+	Value      float64
+	Age        time.Duration
+	Warning    string
+	Critical   string
+	Thresholds string
+}
+
+// ReportGroup is the results of one target merged into a multi-target
+// report, kept together so that they can be shown as a block per target.
+type ReportGroup struct {
+	Name    string
+	Status  nagiosplugin.Status
+	Results []ReportResult
+}
+
+// Series is the full set of data points fetched for a metric, kept for the
+// output formats that can show more than the perfdata summary.
+type Series struct {
+	Label      string
+	DataPoints []model.DataPoint
+}
+
+type ReportResult struct {
+	Status  nagiosplugin.Status
+	Message string
+}
+
+// PerfDatum is a single nagios performance data value. Min, Max, Warn and
+// Crit are optional and left out of the output when nil.
+type PerfDatum struct {
+	Label string
+	Unit  string
+	Value float64
+	Min   *float64
+	Max   *float64
+	Warn  *float64
+	Crit  *float64
+}
+
+func NewReport() *Report {
+	return &Report{}
+}
+
+func (report *Report) AddResult(status nagiosplugin.Status, message string) {
+	report.Results = append(report.Results, ReportResult{Status: status, Message: message})
+	if status > report.Status {
+		report.Status = status
+	}
+}
+
+func (report *Report) AddResultf(status nagiosplugin.Status, format string, v ...interface{}) {
+	report.AddResult(status, fmt.Sprintf(format, v...))
+}
+
+// Downgrade lowers every result with status from to status to, noting why
+// after its message.
+func (report *Report) Downgrade(from nagiosplugin.Status, to nagiosplugin.Status, note string) {
+	report.Status = nagiosplugin.OK
+	for i, result := range report.Results {
+		if result.Status == from {
+			report.Results[i] = ReportResult{Status: to, Message: fmt.Sprintf("%v (%v)", result.Message, note)}
+		}
+		if report.Results[i].Status > report.Status {
+			report.Status = report.Results[i].Status
+		}
+	}
+}
+
+// AddPerfDatum adds a performance data value. The optional thresholds are
+// min, max, warn and crit, in the same order nagiosplugin.Check expects,
+// with NaN for one that is not set.
+func (report *Report) AddPerfDatum(label string, unit string, value float64, thresholds ...float64) error {
+	if !validPerfUnits[unit] {
+		return errors.New(fmt.Sprintf("Invalid perfdata unit %v", unit))
+	}
+
+	datum := PerfDatum{Label: label, Unit: unit, Value: value}
+	for i, fields := range []**float64{&datum.Min, &datum.Max, &datum.Warn, &datum.Crit} {
+		if i < len(thresholds) && !math.IsNaN(thresholds[i]) {
+			threshold := thresholds[i]
+			*fields = &threshold
+		}
+	}
+
+	report.PerfData = append(report.PerfData, datum)
+	return nil
+}
+
+func (report *Report) AddSeries(label string, dataPoints []model.DataPoint) {
+	report.Series = append(report.Series, Series{Label: label, DataPoints: dataPoints})
+}
+
+// Merge adds the results and performance data of another report, prefixing
+// messages and perfdata labels with name so that targets can be told apart.
+func (report *Report) Merge(name string, other *Report) {
+	if len(other.Results) == 0 {
+		report.AddResultf(nagiosplugin.UNKNOWN, "%v: no check result specified", name)
+	}
+
+	for _, result := range other.Results {
+		report.AddResultf(result.Status, "%v: %v", name, result.Message)
+	}
+
+	report.Groups = append(report.Groups, ReportGroup{Name: name, Status: other.ExitStatus(), Results: other.Results})
+
+	for _, datum := range other.PerfData {
+		datum.Label = fmt.Sprintf("%v_%v", SanitizeLabel(name), datum.Label)
+		report.PerfData = append(report.PerfData, datum)
+	}
+
+	for _, series := range other.Series {
+		report.AddSeries(fmt.Sprintf("%v_%v", SanitizeLabel(name), series.Label), series.DataPoints)
+	}
+}
+
+// LongOutput renders the merged targets as nagios long output, one block per
+// target with its results indented beneath, even when the target was merged
+// more than once, e.g. once per metric. It is empty for reports without
+// merged targets.
+func (report *Report) LongOutput() string {
+	var names []string
+	groups := map[string]*ReportGroup{}
+	for _, group := range report.Groups {
+		merged, ok := groups[group.Name]
+		if ok == false {
+			merged = &ReportGroup{Name: group.Name}
+			groups[group.Name] = merged
+			names = append(names, group.Name)
+		}
+
+		if group.Status > merged.Status {
+			merged.Status = group.Status
+		}
+		merged.Results = append(merged.Results, group.Results...)
+	}
+
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%v: %v", name, groups[name].Status))
+		for _, result := range groups[name].Results {
+			lines = append(lines, fmt.Sprintf("  %v: %v", result.Status, result.Message))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Append adds the results, performance data and series of another report
+// unchanged.
+func (report *Report) Append(other *Report) {
+	for _, result := range other.Results {
+		report.AddResult(result.Status, result.Message)
+	}
+
+	report.PerfData = append(report.PerfData, other.PerfData...)
+	report.Series = append(report.Series, other.Series...)
+	report.Groups = append(report.Groups, other.Groups...)
+}
+
+// PrefixPerfData prefixes the labels of all perfdata and series added so far.
+func (report *Report) PrefixPerfData(prefix string) {
+	for i := range report.PerfData {
+		report.PerfData[i].Label = prefix + report.PerfData[i].Label
+	}
+
+	for i := range report.Series {
+		report.Series[i].Label = prefix + report.Series[i].Label
+	}
+}
+
+// CompactPerfData rounds the perfdata values and thresholds to precision
+// decimal places and drops their min and max, to shorten the output.
+func (report *Report) CompactPerfData(precision int) {
+	scale := math.Pow(10, float64(precision))
+	round := func(value float64) float64 {
+		return math.Round(value*scale) / scale
+	}
+
+	for i := range report.PerfData {
+		datum := &report.PerfData[i]
+		datum.Value = round(datum.Value)
+		datum.Min, datum.Max = nil, nil
+		for _, field := range []*float64{datum.Warn, datum.Crit} {
+			if field != nil {
+				*field = round(*field)
+			}
+		}
+	}
+}
+
+// SanitizeLabel replaces every character that is not safe in a nagios
+// perfdata label with an underscore.
+func SanitizeLabel(label string) string {
+	return unsafeLabelPattern.ReplaceAllString(label, "_")
+}
+
+// Check replays the report into a nagiosplugin.Check for the default output.
+func (report *Report) Check() *nagiosplugin.Check {
+	check := nagiosplugin.NewCheck()
+	for _, result := range report.Results {
+		check.AddResult(result.Status, result.Message)
+	}
+
+	for _, datum := range report.PerfData {
+		check.AddPerfDatum(datum.Label, datum.Unit, datum.Value, datum.thresholds()...)
+	}
+
+	return check
+}
+
+// Message joins the messages of all results, most severe first.
+func (report *Report) Message() string {
+	if len(report.Results) == 0 {
+		return "no check result specified"
+	}
+
+	var important []string
+	var unimportant []string
+	for _, result := range report.Results {
+		if result.Status == report.Status {
+			important = append(important, result.Message)
+		} else {
+			unimportant = append(unimportant, result.Message)
+		}
+	}
+
+	return strings.Join(append(important, unimportant...), ", ")
+}
+
+// ExitStatus is the status the plugin should exit with. A report without any
+// results is UNKNOWN, as it is for nagiosplugin.Check.
+func (report *Report) ExitStatus() nagiosplugin.Status {
+	if len(report.Results) == 0 {
+		return nagiosplugin.UNKNOWN
+	}
+
+	return report.Status
+}
+
+// StrictString renders the report as a single "STATUS - message | perfdata"
+// line, with newlines removed and the message truncated to maxLength
+// characters, for consumers that cannot cope with anything else.
+func (report *Report) StrictString(maxLength int) string {
+	message := strings.Join(strings.Fields(report.Message()), " ")
+	if maxLength > 3 && len(message) > maxLength {
+		message = message[:maxLength-3] + "..."
+	}
+
+	line := fmt.Sprintf("%v - %v", report.ExitStatus(), message)
+	if len(report.PerfData) == 0 {
+		return line
+	}
+
+	perfData := make([]string, len(report.PerfData))
+	for i, datum := range report.PerfData {
+		perfData[i] = datum.String()
+	}
+
+	return fmt.Sprintf("%v | %v", line, strings.Join(perfData, " "))
+}
+
+type jsonReport struct {
+	Status     string                     `json:"status"`
+	ExitCode   int                        `json:"exitCode"`
+	Message    string                     `json:"message"`
+	Metric     string                     `json:"metric,omitempty"`
+	Value      *float64                   `json:"value,omitempty"`
+	AgeSeconds *float64                   `json:"ageSeconds,omitempty"`
+	Warning    string                     `json:"warning,omitempty"`
+	Critical   string                     `json:"critical,omitempty"`
+	Thresholds string                     `json:"thresholds,omitempty"`
+	Results    []jsonResult               `json:"results"`
+	PerfData   []jsonPerfDatum            `json:"perfData"`
+	Series     map[string][]jsonDataPoint `json:"series,omitempty"`
+}
+
+type jsonResult struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type jsonPerfDatum struct {
+	Label string   `json:"label"`
+	Unit  string   `json:"unit"`
+	Value float64  `json:"value"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+	Warn  *float64 `json:"warn,omitempty"`
+	Crit  *float64 `json:"crit,omitempty"`
+}
+
+type jsonDataPoint struct {
+	Timestamp string  `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// JSON renders the report as a JSON object. The observation and series are
+// only included when they were added to the report.
+func (report *Report) JSON() ([]byte, error) {
+	status := report.ExitStatus()
+	out := jsonReport{
+		Status:   status.String(),
+		ExitCode: int(status),
+		Message:  report.Message(),
+		Results:  []jsonResult{},
+		PerfData: []jsonPerfDatum{},
+	}
+
+	if observation := report.Observation; observation != nil {
+		value, age := observation.Value, observation.Age.Seconds()
+		out.Metric = observation.Metric
+		out.Value, out.AgeSeconds = &value, &age
+		out.Warning, out.Critical, out.Thresholds = observation.Warning, observation.Critical, observation.Thresholds
+	}
+
+	for _, result := range report.Results {
+		out.Results = append(out.Results, jsonResult{Status: result.Status.String(), Message: result.Message})
+	}
+
+	for _, datum := range report.PerfData {
+		out.PerfData = append(out.PerfData, jsonPerfDatum{datum.Label, datum.Unit, datum.Value, datum.Min, datum.Max, datum.Warn, datum.Crit})
+	}
+
+	if len(report.Series) > 0 {
+		out.Series = map[string][]jsonDataPoint{}
+		for _, series := range report.Series {
+			dataPoints := make([]jsonDataPoint, len(series.DataPoints))
+			for i, dataPoint := range series.DataPoints {
+				dataPoints[i] = jsonDataPoint{Timestamp: dataPoint.Timestamp.UTC().Format(time.RFC3339), Value: dataPoint.Value}
+			}
+			out.Series[series.Label] = dataPoints
+		}
+	}
+
+	body, err := json.Marshal(out)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to encode JSON output. Error: %v", err))
+	}
+
+	return body, nil
+}
+
+// CSV renders the report as a header row followed by one row per data point
+// of each series, with the status of the report. A report without series has
+// one row per perfdata value instead, without a timestamp.
+func (report *Report) CSV() ([]byte, error) {
+	status := report.ExitStatus().String()
+	rows := [][]string{{"timestamp", "metric", "value", "status"}}
+	for _, series := range report.Series {
+		for _, dataPoint := range series.DataPoints {
+			value := ""
+			if !dataPoint.Null {
+				value = formatPerfFloat(dataPoint.Value)
+			}
+			rows = append(rows, []string{dataPoint.Timestamp.UTC().Format(time.RFC3339), series.Label, value, status})
+		}
+	}
+
+	if len(report.Series) == 0 {
+		for _, datum := range report.PerfData {
+			rows = append(rows, []string{"", datum.Label, formatPerfFloat(datum.Value), status})
+		}
+	}
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.WriteAll(rows)
+	if err := writer.Error(); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to encode CSV output. Error: %v", err))
+	}
+
+	return buffer.Bytes(), nil
+}
+
+var influxTagEscaper = strings.NewReplacer(",", "\\,", " ", "\\ ", "=", "\\=")
+
+// InfluxLineProtocol renders the perfdata of the report, and the data points
+// of each series, as InfluxDB line protocol in the given measurement, tagged
+// with their label. Perfdata is timestamped with the current time.
+func (report *Report) InfluxLineProtocol(measurement string) []byte {
+	var buffer bytes.Buffer
+	now := time.Now()
+	for _, datum := range report.PerfData {
+		fmt.Fprintf(&buffer, "%v,label=%v value=%v %v\n", measurement, influxTagEscaper.Replace(datum.Label), formatPerfFloat(datum.Value), now.UnixNano())
+	}
+
+	for _, series := range report.Series {
+		for _, dataPoint := range series.DataPoints {
+			if dataPoint.Null {
+				continue
+			}
+			fmt.Fprintf(&buffer, "%v,label=%v value=%v %v\n", measurement, influxTagEscaper.Replace(series.Label), formatPerfFloat(dataPoint.Value), dataPoint.Timestamp.UnixNano())
+		}
+	}
+
+	return buffer.Bytes()
+}
+
+// String renders the datum in the nagios 'label'=value[UOM];[warn];[crit];[min];[max] format.
+func (datum PerfDatum) String() string {
+	value := fmt.Sprintf("'%v'=%v%v", strings.Replace(datum.Label, "'", "", -1), formatPerfFloat(datum.Value), datum.Unit)
+	fields := []string{value, "", "", "", ""}
+	for i, field := range []*float64{datum.Warn, datum.Crit, datum.Min, datum.Max} {
+		if field != nil {
+			fields[i+1] = formatPerfFloat(*field)
+		}
+	}
+
+	return strings.TrimRight(strings.Join(fields, ";"), ";")
+}
+
+// thresholds returns the min, max, warn and crit arguments of
+// nagiosplugin's AddPerfDatum, which are positional, so a field that is not
+// set before one that is, such as the min and max dropped by
+// CompactPerfData, is passed as NaN and rendered empty.
+func (datum PerfDatum) thresholds() []float64 {
+	var thresholds []float64
+	fields := []*float64{datum.Min, datum.Max, datum.Warn, datum.Crit}
+	for i, field := range fields {
+		if field != nil {
+			for len(thresholds) < i {
+				thresholds = append(thresholds, math.NaN())
+			}
+			thresholds = append(thresholds, *field)
+		}
+	}
+
+	return thresholds
+}
+
+func formatPerfFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
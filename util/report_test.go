@@ -0,0 +1,62 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompactPerfDataKeepsThresholds(t *testing.T) {
+	tests := []struct {
+		name       string
+		thresholds []float64
+		want       string
+		wantArgs   []float64
+	}{
+		{"no thresholds", nil, "'metric'=1.23", nil},
+		{"min and max only", []float64{0, 100}, "'metric'=1.23", nil},
+		{"warn", []float64{0, 100, 5.555}, "'metric'=1.23;5.56", []float64{math.NaN(), math.NaN(), 5.56}},
+		{"warn and crit", []float64{0, 100, 5.555, 10.001}, "'metric'=1.23;5.56;10", []float64{math.NaN(), math.NaN(), 5.56, 10}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := NewReport()
+			if err := report.AddPerfDatum("metric", "", 1.2345, test.thresholds...); err != nil {
+				t.Fatalf("AddPerfDatum: %v", err)
+			}
+			report.CompactPerfData(2)
+
+			datum := report.PerfData[0]
+			if got := datum.String(); got != test.want {
+				t.Errorf("String() = %q, want %q", got, test.want)
+			}
+
+			args := datum.thresholds()
+			if len(args) != len(test.wantArgs) {
+				t.Fatalf("thresholds() = %v, want %v", args, test.wantArgs)
+			}
+			for i := range args {
+				if math.IsNaN(test.wantArgs[i]) != math.IsNaN(args[i]) || (!math.IsNaN(args[i]) && args[i] != test.wantArgs[i]) {
+					t.Errorf("thresholds() = %v, want %v", args, test.wantArgs)
+				}
+			}
+		})
+	}
+}
+
+func TestAddPerfDatumNaNThreshold(t *testing.T) {
+	report := NewReport()
+	report.AddPerfDatum("metric", "", 1, math.NaN(), math.NaN(), 5, 10)
+
+	datum := report.PerfData[0]
+	if datum.Min != nil || datum.Max != nil {
+		t.Errorf("NaN min and max were kept: %v", datum)
+	}
+	if datum.Warn == nil || *datum.Warn != 5 || datum.Crit == nil || *datum.Crit != 10 {
+		t.Errorf("warn and crit were not kept: %v", datum)
+	}
+}
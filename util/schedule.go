@@ -0,0 +1,109 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ActiveWindow is a weekly schedule such as "Mon-Fri 09:00-18:00
+// Europe/Berlin". A window whose end is not after its start runs past
+// midnight into the next day.
+type ActiveWindow struct {
+	days     [7]bool
+	start    int
+	end      int
+	location *time.Location
+}
+
+// ParseActiveWindow parses a schedule of days, a time range and an optional
+// time zone, which defaults to the local one. Days are a comma separated list
+// of days or day ranges, e.g. Mon-Fri or Mon,Wed,Sat-Sun.
+func ParseActiveWindow(spec string) (*ActiveWindow, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, errors.New(fmt.Sprintf("Invalid active window %v. Expected days HH:MM-HH:MM [time zone]", spec))
+	}
+
+	window := &ActiveWindow{location: time.Local}
+	for _, part := range strings.Split(fields[0], ",") {
+		bounds := strings.SplitN(strings.ToLower(part), "-", 2)
+		first, ok := weekdays[bounds[0]]
+		if ok == false {
+			return nil, errors.New(fmt.Sprintf("Invalid day %v in active window", bounds[0]))
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[bounds[1]]; ok == false {
+				return nil, errors.New(fmt.Sprintf("Invalid day %v in active window", bounds[1]))
+			}
+		}
+
+		for day := first; ; day = (day + 1) % 7 {
+			window.days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	times := strings.SplitN(fields[1], "-", 2)
+	if len(times) != 2 {
+		return nil, errors.New(fmt.Sprintf("Invalid time range %v in active window. Expected HH:MM-HH:MM", fields[1]))
+	}
+
+	var err error
+	if window.start, err = parseClock(times[0]); err != nil {
+		return nil, err
+	}
+	if window.end, err = parseClock(times[1]); err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 3 {
+		if window.location, err = time.LoadLocation(fields[2]); err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid time zone %v in active window. Error: %v", fields[2], err))
+		}
+	}
+
+	return window, nil
+}
+
+// Contains reports whether t falls inside the window.
+func (window *ActiveWindow) Contains(t time.Time) bool {
+	t = t.In(window.location)
+	minute := t.Hour()*60 + t.Minute()
+
+	if window.start < window.end {
+		return window.days[t.Weekday()] && minute >= window.start && minute < window.end
+	}
+
+	yesterday := (t.Weekday() + 6) % 7
+	return (window.days[t.Weekday()] && minute >= window.start) || (window.days[yesterday] && minute < window.end)
+}
+
+// parseClock parses HH:MM into minutes after midnight.
+func parseClock(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid time %v in active window. Expected HH:MM", clock))
+	}
+
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
@@ -0,0 +1,252 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"../model"
+	"errors"
+	"fmt"
+	"github.com/fractalcat/nagiosplugin"
+	"strconv"
+	"strings"
+)
+
+var sizeSuffixes = map[string]float64{
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+	"P": 1 << 50,
+}
+
+var unitBytes = map[string]float64{
+	"BYTES":     1,
+	"KILOBYTES": 1 << 10,
+	"MEGABYTES": 1 << 20,
+	"GIGABYTES": 1 << 30,
+	"TERABYTES": 1 << 40,
+	"PETABYTES": 1 << 50,
+}
+
+// ConvertRange rewrites a nagios threshold range that uses human friendly
+// values (8G, 500M, 90%) into a plain numeric range in the metric's native
+// units, so that it can be handed to nagiosplugin.ParseRange.
+func ConvertRange(rangeStr string, units string) (string, error) {
+	prefix := ""
+	body := rangeStr
+	if strings.HasPrefix(body, "@") {
+		prefix = "@"
+		body = body[1:]
+	}
+
+	parts := strings.SplitN(body, ":", 2)
+	for i, part := range parts {
+		if part == "" || part == "~" {
+			continue
+		}
+
+		value, err := convertValue(part, units)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = value
+	}
+
+	return prefix + strings.Join(parts, ":"), nil
+}
+
+// ScaleRange converts a threshold range like ConvertRange and multiplies each
+// of its bounds by factor.
+func ScaleRange(rangeStr string, units string, factor float64) (string, error) {
+	converted, err := ConvertRange(rangeStr, units)
+	if err != nil {
+		return "", err
+	}
+
+	prefix := ""
+	if strings.HasPrefix(converted, "@") {
+		prefix = "@"
+		converted = converted[1:]
+	}
+
+	parts := strings.SplitN(converted, ":", 2)
+	for i, part := range parts {
+		if part == "" || part == "~" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("Threshold %v is not a valid number", part))
+		}
+		parts[i] = strconv.FormatFloat(value*factor, 'f', -1, 64)
+	}
+
+	return prefix + strings.Join(parts, ":"), nil
+}
+
+// ParseValue parses a single threshold style value, which may use the same
+// suffixes as ConvertRange, into the given metric units.
+func ParseValue(value string, units string) (float64, error) {
+	converted, err := convertValue(value, units)
+	if err != nil {
+		return 0, err
+	}
+
+	parsed, err := strconv.ParseFloat(converted, 64)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("%v is not a valid number", value))
+	}
+
+	return parsed, nil
+}
+
+func convertValue(value string, units string) (string, error) {
+	if strings.HasSuffix(value, "%") {
+		if units != "PERCENT" {
+			return "", errors.New(fmt.Sprintf("Threshold %v is a percentage but the metric is measured in %v", value, units))
+		}
+		return strings.TrimSuffix(value, "%"), nil
+	}
+
+	number := strings.TrimRight(value, "Bb")
+	if number == "" {
+		return value, nil
+	}
+
+	multiplier, ok := sizeSuffixes[strings.ToUpper(number[len(number)-1:])]
+	if ok {
+		number = number[:len(number)-1]
+	} else if number != value {
+		// A B on its own is a number of bytes.
+		multiplier = 1
+	} else {
+		return value, nil
+	}
+
+	divisor, ok := unitBytes[units]
+	if ok == false {
+		return "", errors.New(fmt.Sprintf("Threshold %v has a size suffix but the metric is measured in %v", value, units))
+	}
+
+	parsed, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Threshold %v is not a valid number", value))
+	}
+
+	return strconv.FormatFloat(parsed*multiplier/divisor, 'f', -1, 64), nil
+}
+
+// alertUnitSuffixes maps the units of Ops Manager alert thresholds to the
+// size suffixes understood by ConvertRange. Raw thresholds, such as counts and
+// percentages, are in the units of the metric already.
+var alertUnitSuffixes = map[string]string{
+	"":          "",
+	"RAW":       "",
+	"BYTES":     "B",
+	"KILOBYTES": "K",
+	"MEGABYTES": "M",
+	"GIGABYTES": "G",
+	"TERABYTES": "T",
+	"PETABYTES": "P",
+}
+
+// AlertThresholdRange converts the threshold of an Ops Manager alert config
+// into a nagios range that alerts under the same condition. Thresholds in units
+// that cannot be converted to those of the metric, such as durations, are an
+// error.
+func AlertThresholdRange(threshold *model.MetricThreshold) (string, error) {
+	suffix, ok := alertUnitSuffixes[threshold.Units]
+	if ok == false {
+		return "", errors.New(fmt.Sprintf("Alert threshold units %v are not supported", threshold.Units))
+	}
+	value := strconv.FormatFloat(threshold.Threshold, 'f', -1, 64) + suffix
+
+	switch threshold.Operator {
+	case "GREATER_THAN":
+		return "~:" + value, nil
+	case "LESS_THAN":
+		return value + ":", nil
+	}
+
+	return "", errors.New(fmt.Sprintf("Unsupported alert threshold operator %v", threshold.Operator))
+}
+
+// ThresholdStep is one step of a stepped threshold specification such as
+// warn:70,crit:85,emergency:95.
+type ThresholdStep struct {
+	Name   string
+	Status nagiosplugin.Status
+	Value  float64
+}
+
+var stepStatuses = map[string]nagiosplugin.Status{
+	"warn":      nagiosplugin.WARNING,
+	"crit":      nagiosplugin.CRITICAL,
+	"emergency": nagiosplugin.CRITICAL,
+}
+
+var stepOrder = []string{"warn", "crit", "emergency"}
+
+// ParseSteppedThresholds parses a comma separated list of name:value steps.
+// Steps are named warn, crit or emergency, may use the same suffixes as
+// ConvertRange and must increase in that order.
+func ParseSteppedThresholds(spec string, units string) ([]ThresholdStep, error) {
+	values := map[string]float64{}
+	for _, part := range strings.Split(spec, ",") {
+		pieces := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		if len(pieces) != 2 {
+			return nil, errors.New(fmt.Sprintf("Invalid threshold step %v. Expected name:value", part))
+		}
+
+		name := strings.ToLower(pieces[0])
+		if _, ok := stepStatuses[name]; ok == false {
+			return nil, errors.New(fmt.Sprintf("Invalid threshold step name %v. Acceptable names are warn crit emergency", pieces[0]))
+		}
+
+		if _, ok := values[name]; ok {
+			return nil, errors.New(fmt.Sprintf("Threshold step %v is given more than once", name))
+		}
+
+		converted, err := convertValue(pieces[1], units)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := strconv.ParseFloat(converted, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Threshold step %v has an invalid value %v", name, pieces[1]))
+		}
+		values[name] = value
+	}
+
+	var steps []ThresholdStep
+	for _, name := range stepOrder {
+		value, ok := values[name]
+		if ok == false {
+			continue
+		}
+
+		if len(steps) > 0 && value <= steps[len(steps)-1].Value {
+			return nil, errors.New(fmt.Sprintf("Threshold step %v must be greater than %v", name, steps[len(steps)-1].Name))
+		}
+		steps = append(steps, ThresholdStep{Name: name, Status: stepStatuses[name], Value: value})
+	}
+
+	return steps, nil
+}
+
+// BreachedStep returns the highest step that value exceeds, or nil if it
+// exceeds none of them.
+func BreachedStep(steps []ThresholdStep, value float64) *ThresholdStep {
+	var breached *ThresholdStep
+	for i := range steps {
+		if value > steps[i].Value {
+			breached = &steps[i]
+		}
+	}
+
+	return breached
+}
@@ -0,0 +1,136 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"../model"
+	"testing"
+)
+
+func TestConvertRange(t *testing.T) {
+	tests := []struct {
+		rangeStr string
+		units    string
+		want     string
+		valid    bool
+	}{
+		// Plain numbers are left as they are, whatever the units.
+		{"100", "BYTES", "100", true},
+		{"10:20", "COUNT", "10:20", true},
+		{"", "BYTES", "", true},
+
+		// Size suffixes are converted into the units of the metric.
+		{"8G", "BYTES", "8589934592", true},
+		{"8GB", "BYTES", "8589934592", true},
+		{"8gb", "BYTES", "8589934592", true},
+		{"500M", "BYTES", "524288000", true},
+		{"1K", "BYTES", "1024", true},
+		{"1P", "BYTES", "1125899906842624", true},
+		{"8G", "MEGABYTES", "8192", true},
+		{"512M", "GIGABYTES", "0.5", true},
+		{"1.5G", "MEGABYTES", "1536", true},
+		{"0G", "BYTES", "0", true},
+		{"8B", "BYTES", "8", true},
+		{"8b", "BYTES", "8", true},
+		{"2048B", "KILOBYTES", "2", true},
+
+		// Both ends of a range, an open end and an inverted range.
+		{"1K:2K", "BYTES", "1024:2048", true},
+		{"@1K:2K", "BYTES", "@1024:2048", true},
+		{"~:1G", "MEGABYTES", "~:1024", true},
+		{"1G:", "MEGABYTES", "1024:", true},
+
+		// Percentages only apply to metrics measured in percent.
+		{"90%", "PERCENT", "90", true},
+		{"80%:90%", "PERCENT", "80:90", true},
+		{"@0%:10%", "PERCENT", "@0:10", true},
+		{"100.5%", "PERCENT", "100.5", true},
+		{"90%", "BYTES", "", false},
+		{"90%", "", "", false},
+
+		// Size suffixes only apply to metrics measured in bytes.
+		{"8G", "PERCENT", "", false},
+		{"8G", "COUNT", "", false},
+		{"8B", "COUNT", "", false},
+		{"8B", "PERCENT", "", false},
+		{"xG", "BYTES", "", false},
+		{"1K:xM", "BYTES", "", false},
+	}
+
+	for _, test := range tests {
+		got, err := ConvertRange(test.rangeStr, test.units)
+		if test.valid && (err != nil || got != test.want) {
+			t.Errorf("ConvertRange(%q, %q) = %q, %v, want %q", test.rangeStr, test.units, got, err, test.want)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("ConvertRange(%q, %q) = %q, want an error", test.rangeStr, test.units, got)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		value string
+		units string
+		want  float64
+		valid bool
+	}{
+		{"8G", "BYTES", 8589934592, true},
+		{"1M", "KILOBYTES", 1024, true},
+		{"42", "COUNT", 42, true},
+		{"90%", "PERCENT", 90, true},
+		{"90%", "BYTES", 0, false},
+		{"lots", "COUNT", 0, false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseValue(test.value, test.units)
+		if test.valid && (err != nil || got != test.want) {
+			t.Errorf("ParseValue(%q, %q) = %v, %v, want %v", test.value, test.units, got, err, test.want)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("ParseValue(%q, %q) = %v, want an error", test.value, test.units, got)
+		}
+	}
+}
+
+func TestAlertThresholdRange(t *testing.T) {
+	tests := []struct {
+		operator  string
+		threshold float64
+		units     string
+		want      string
+		valid     bool
+	}{
+		{"GREATER_THAN", 500, "RAW", "~:500", true},
+		{"GREATER_THAN", 90, "", "~:90", true},
+		{"LESS_THAN", 10, "RAW", "10:", true},
+		{"GREATER_THAN", 8, "GIGABYTES", "~:8G", true},
+		{"GREATER_THAN", 512, "BYTES", "~:512B", true},
+
+		{"GREATER_THAN", 100, "MILLISECONDS", "", false},
+		{"GREATER_THAN", 1, "SECONDS", "", false},
+		{"GREATER_THAN", 1, "MEGABITS", "", false},
+		{"EQUALS", 1, "RAW", "", false},
+	}
+
+	for _, test := range tests {
+		got, err := AlertThresholdRange(&model.MetricThreshold{MetricName: "M", Operator: test.operator, Threshold: test.threshold, Units: test.units})
+		if !test.valid {
+			if err == nil {
+				t.Errorf("AlertThresholdRange(%v %v %v) = %q, want an error", test.operator, test.threshold, test.units, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("AlertThresholdRange(%v %v %v) = %q, %v, want %q", test.operator, test.threshold, test.units, got, err, test.want)
+		}
+
+		// The range must convert for a metric measured in bytes.
+		if _, err := ConvertRange(got, "BYTES"); err != nil {
+			t.Errorf("ConvertRange(%q): %v", got, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 MongoDB, Inc. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"../model"
+	"fmt"
+	"sync"
+	"time"
+)
+
+func topologyKey(groupId string) string {
+	return fmt.Sprintf("topology/%v", groupId)
+}
+
+// CachedHosts returns the hosts of the group, reusing the list fetched by an
+// earlier run for up to ttl. Only the topology of the cached hosts can be
+// relied on: their last ping and replica state are as old as the cache.
+func CachedHosts(api *MMSAPI, cache *Cache, groupId string, ttl time.Duration) ([]model.Host, error) {
+	var hosts []model.Host
+	if cache.Get(topologyKey(groupId), &hosts) {
+		return hosts, nil
+	}
+
+	hosts, err := api.GetAllHosts(groupId)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Set(topologyKey(groupId), hosts, ttl)
+	cache.Save()
+
+	return hosts, nil
+}
+
+// InvalidateHosts drops the cached hosts of the group, so that the next run
+// fetches the topology again.
+func InvalidateHosts(cache *Cache, groupId string) {
+	cache.Delete(topologyKey(groupId))
+	cache.Save()
+}
+
+// RefreshHosts fetches the current state of each of the hosts, such as their
+// last ping, which cached hosts do not keep up to date. It fails if any of
+// them cannot be fetched, e.g. because it was removed since it was cached.
+func RefreshHosts(api *MMSAPI, groupId string, hosts []model.Host) ([]model.Host, error) {
+	refreshed := make([]model.Host, len(hosts))
+	errs := make([]error, len(hosts))
+	var wg sync.WaitGroup
+	for i := range hosts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			host, err := api.GetHost(groupId, hosts[i].Id)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			refreshed[i] = *host
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return refreshed, nil
+}